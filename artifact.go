@@ -0,0 +1,149 @@
+package main
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"strings"
+	"sync"
+	"time"
+)
+
+// ARTIFACT_MANIFEST is the name of the manifest in an artifact built by spm pack.
+const ARTIFACT_MANIFEST = "spm-artifact.json"
+
+// Artifact is a prebuilt deployment of packages: the metadata zips of the packages in deploy order
+// (dependencies first) and the manifest describing them.
+type Artifact struct {
+	SpmVersion string             `json:"spm_version"`
+	CreatedAt  time.Time          `json:"created_at"`
+	Packages   []*ArtifactPackage `json:"packages"`
+	zips       map[string][]byte
+	mu         sync.Mutex
+}
+
+type ArtifactPackage struct {
+	URI          string   `json:"uri"`
+	Commit       string   `json:"commit,omitempty"`
+	Dependencies []string `json:"dependencies,omitempty"`
+	Zip          string   `json:"zip"`
+	SHA256       string   `json:"sha256"`
+}
+
+func NewArtifact() *Artifact {
+	return &Artifact{
+		SpmVersion: Version,
+		CreatedAt:  time.Now(),
+		Packages:   []*ArtifactPackage{},
+		zips:       map[string][]byte{},
+	}
+}
+
+// Add appends the metadata zip of the package. It is safe for concurrent use.
+func (a *Artifact) Add(uri string, commit string, dependencies []string, zip []byte) error {
+	a.mu.Lock()
+	defer a.mu.Unlock()
+	sum := sha256.Sum256(zip)
+	p := &ArtifactPackage{
+		URI:    registryURI(uri),
+		Commit: commit,
+		Zip:    fmt.Sprintf("packages/%02d-%s.zip", len(a.Packages)+1, strings.TrimPrefix(registryName(uri), REGISTRY_PREFIX)),
+		SHA256: hex.EncodeToString(sum[:]),
+	}
+	for _, dep := range dependencies {
+		p.Dependencies = append(p.Dependencies, registryURI(dep))
+	}
+	a.Packages = append(a.Packages, p)
+	a.zips[p.Zip] = zip
+	return nil
+}
+
+// Zip returns the metadata zip of the package.
+func (a *Artifact) Zip(p *ArtifactPackage) []byte {
+	return a.zips[p.Zip]
+}
+
+// Write writes the artifact as a zip of the manifest and the metadata zips.
+func (a *Artifact) Write(path string) error {
+	manifest, err := json.MarshalIndent(a, "", "  ")
+	if err != nil {
+		return err
+	}
+	files := []*File{{Name: ARTIFACT_MANIFEST, Body: manifest}}
+	for _, p := range a.Packages {
+		files = append(files, &File{Name: p.Zip, Body: a.zips[p.Zip]})
+	}
+	zipped, err := NewZipConverter().Convert(files)
+	if err != nil {
+		return err
+	}
+	return writeFileAtomic(path, zipped[0].Body, 0644)
+}
+
+// readArtifact reads the artifact and verifies the checksums of the metadata zips.
+func readArtifact(path string) (*Artifact, error) {
+	buf, err := ioutil.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+	files, err := unzipFiles(buf)
+	if err != nil {
+		return nil, fmt.Errorf("%s is not an artifact: %s", path, err)
+	}
+	a := &Artifact{zips: map[string][]byte{}}
+	found := false
+	for _, f := range files {
+		if f.Name == ARTIFACT_MANIFEST {
+			if err := json.Unmarshal(f.Body, a); err != nil {
+				return nil, err
+			}
+			found = true
+			continue
+		}
+		a.zips[f.Name] = f.Body
+	}
+	if !found {
+		return nil, fmt.Errorf("%s is not an artifact: %s not found", path, ARTIFACT_MANIFEST)
+	}
+	for _, p := range a.Packages {
+		zip, ok := a.zips[p.Zip]
+		if !ok {
+			return nil, fmt.Errorf("%s: %s is not found in the artifact", p.URI, p.Zip)
+		}
+		sum := sha256.Sum256(zip)
+		if hex.EncodeToString(sum[:]) != p.SHA256 {
+			return nil, fmt.Errorf("%s: Checksum of %s does not match the manifest", p.URI, p.Zip)
+		}
+	}
+	return a, nil
+}
+
+// deployArtifact deploys the packages of the artifact in the order they are packed.
+func deployArtifact(logger Logger, config *config, report *CommandReport, path string) error {
+	a, err := readArtifact(path)
+	if err != nil {
+		return err
+	}
+	logger.Infof("%s: %d packages (packed at %s by spm %s)", path, len(a.Packages), a.CreatedAt.Format(time.RFC3339), a.SpmVersion)
+	for _, p := range a.Packages {
+		installer, err := NewSalesforceInstaller(logger, nil, config, p.URI)
+		if err != nil {
+			return err
+		}
+		installer.report = report
+		installer.result = NewPackageResult(p.URI)
+		installer.result.Commit = p.Commit
+		// the records are installed now, not when the artifact is packed
+		zip, err := touchRegistryRecord(a.Zip(p), p.URI)
+		if err == nil {
+			err = installer.deployZip(zip)
+		}
+		installer.finish(err)
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
@@ -0,0 +1,81 @@
+package main
+
+import (
+	"io/ioutil"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestPackAndDeployArtifact(t *testing.T) {
+	dir, err := ioutil.TempDir("", "spm")
+	assert.Nil(t, err)
+	defer os.RemoveAll(dir)
+	path := filepath.Join(dir, "artifact.zip")
+
+	// packs never log in to the org
+	p := newParallelInstaller("http://127.0.0.1:1", map[string][]*File{
+		"https://github.com/tzmfreedom/a": packageFiles("A", "packages:\n  - tzmfreedom/b\n"),
+		"https://github.com/tzmfreedom/b": packageFiles("B", ""),
+	})
+	p.config.IsPackOnly = true
+	p.artifact = NewArtifact()
+	assert.Nil(t, p.Install([]string{"https://github.com/tzmfreedom/a"}))
+	assert.Nil(t, p.artifact.Write(path))
+
+	a, err := readArtifact(path)
+	assert.Nil(t, err)
+	assert.Equal(t, 2, len(a.Packages))
+	assert.Equal(t, "https://github.com/tzmfreedom/b", a.Packages[0].URI)
+	assert.Equal(t, "packages/01-"+strings.TrimPrefix(registryName("https://github.com/tzmfreedom/b"), REGISTRY_PREFIX)+".zip", a.Packages[0].Zip)
+	assert.Equal(t, "https://github.com/tzmfreedom/a", a.Packages[1].URI)
+	assert.Equal(t, []string{"https://github.com/tzmfreedom/b"}, a.Packages[1].Dependencies)
+	files, err := unzipFiles(a.Zip(a.Packages[1]))
+	assert.Nil(t, err)
+	names := []string{}
+	for _, f := range files {
+		names = append(names, f.Name)
+	}
+	assert.Contains(t, names, "unpackaged/classes/A.cls")
+
+	server := httptest.NewServer(NewMockServer(NewSpmLogger(ioutil.Discard, ioutil.Discard), nil))
+	defer server.Close()
+	config := &config{
+		credentials: credentials{Username: "hoge@example.com", Password: "fuga"},
+		Endpoint:    server.URL,
+		ApiVersion:  "38.0",
+	}
+	report := NewCommandReport("deploy")
+	deployedAt := time.Now()
+	assert.Nil(t, deployArtifact(NewSpmLogger(ioutil.Discard, ioutil.Discard), config, report, path))
+	assert.Equal(t, 2, len(report.Packages))
+	for _, result := range report.Packages {
+		assert.Equal(t, "Succeeded", result.Status)
+	}
+	registry, err := readRegistry(newMockInstaller(t, server.URL, nil).client)
+	assert.Nil(t, err)
+	assert.Equal(t, 2, len(registry.List()))
+	for _, record := range registry.List() {
+		assert.False(t, record.InstalledAt.Before(deployedAt))
+	}
+}
+
+func TestReadArtifactChecksumMismatch(t *testing.T) {
+	dir, err := ioutil.TempDir("", "spm")
+	assert.Nil(t, err)
+	defer os.RemoveAll(dir)
+	path := filepath.Join(dir, "artifact.zip")
+
+	a := NewArtifact()
+	assert.Nil(t, a.Add("https://github.com/tzmfreedom/hoge", "", nil, []byte("zip")))
+	a.zips[a.Packages[0].Zip] = []byte("tampered")
+	assert.Nil(t, a.Write(path))
+
+	_, err = readArtifact(path)
+	assert.EqualError(t, err, "https://github.com/tzmfreedom/hoge: Checksum of "+a.Packages[0].Zip+" does not match the manifest")
+}
@@ -3,14 +3,25 @@ package main
 import (
 	"errors"
 	"fmt"
+	"io"
+	"net"
+	"net/http"
 	"os"
+	"strings"
+	"time"
 
 	"github.com/urfave/cli"
 )
 
 type CLI struct {
-	Config *config
-	logger Logger
+	Config  *config
+	logger  *SpmLogger
+	logFile *os.File
+	// replayListener is the local server of --replay-soap
+	replayListener net.Listener
+	report         *CommandReport
+	outStream      io.Writer
+	errStream      io.Writer
 }
 
 type PackageFile struct {
@@ -29,8 +40,10 @@ const (
 func NewCli() *CLI {
 	logger := NewSpmLogger(os.Stdout, os.Stderr)
 	c := &CLI{
-		logger: logger,
-		Config: &config{},
+		logger:    logger,
+		Config:    &config{},
+		outStream: os.Stdout,
+		errStream: os.Stderr,
 	}
 	cli.OsExiter = func(c int) {}
 	cli.ErrWriter = &NullWriter{}
@@ -47,12 +60,227 @@ func (c *CLI) Run(args []string) error {
 
 	app.Usage = "Salesforce Package Manager"
 	app.Version = Version
+	app.Flags = []cli.Flag{
+		cli.StringFlag{
+			Name:        "ca-bundle",
+			Usage:       "PEM file of CA certificates trusted in addition to the system ones",
+			Destination: &c.Config.CABundle,
+			EnvVar:      "SPM_CA_BUNDLE",
+		},
+		cli.BoolFlag{
+			Name:        "insecure",
+			Usage:       "Skip TLS certificate verification (not recommended)",
+			Destination: &c.Config.Insecure,
+			EnvVar:      "SPM_INSECURE",
+		},
+		cli.IntFlag{
+			Name:        "request-timeout",
+			Value:       300,
+			Usage:       "Timeout seconds of each request to salesforce",
+			Destination: &c.Config.RequestTimeout,
+			EnvVar:      "SPM_REQUEST_TIMEOUT",
+		},
+		cli.IntFlag{
+			Name:        "retries",
+			Value:       3,
+			Usage:       "Number of retries for transient failures",
+			Destination: &c.Config.Retries,
+			EnvVar:      "SPM_RETRIES",
+		},
+		cli.BoolFlag{
+			Name:        "json",
+			Usage:       "Print the result as JSON on stdout. Progress logs go to stderr",
+			Destination: &c.Config.Json,
+		},
+		cli.BoolFlag{
+			Name:        "verbose",
+			Usage:       "Print debug messages including every SOAP request",
+			Destination: &c.Config.Verbose,
+		},
+		cli.BoolFlag{
+			Name:        "quiet, q",
+			Usage:       "Print warnings and errors only",
+			Destination: &c.Config.Quiet,
+		},
+		cli.StringFlag{
+			Name:        "log-level",
+			Usage:       "debug, info, warning or error",
+			Destination: &c.Config.LogLevel,
+			EnvVar:      "SPM_LOG_LEVEL",
+		},
+		cli.StringFlag{
+			Name:        "log-file",
+			Usage:       "Append all messages to the file at debug level",
+			Destination: &c.Config.LogFile,
+			EnvVar:      "SPM_LOG_FILE",
+		},
+		cli.StringFlag{
+			Name:        "trace-soap",
+			Usage:       "Write every SOAP request and response to the directory with secrets redacted",
+			Destination: &c.Config.TraceSOAP,
+			EnvVar:      "SPM_TRACE_SOAP",
+		},
+		cli.StringFlag{
+			Name:        "replay-soap",
+			Usage:       "Answer SOAP requests by the recordings of --trace-soap in the directory instead of salesforce",
+			Destination: &c.Config.ReplaySOAP,
+			EnvVar:      "SPM_REPLAY_SOAP",
+		},
+		cli.IntFlag{
+			Name:        "session-cache",
+			Usage:       "Cache login sessions encrypted in ~/.spm/sessions for the minutes. 0 disables the cache",
+			Destination: &c.Config.SessionCache,
+			EnvVar:      "SPM_SESSION_CACHE",
+		},
+		cli.StringFlag{
+			Name:        "log-format",
+			Value:       "text",
+			Usage:       "text or json",
+			Destination: &c.Config.LogFormat,
+			EnvVar:      "SPM_LOG_FORMAT",
+		},
+	}
+	app.Before = func(ctx *cli.Context) error {
+		if c.Config.Json {
+			c.logger.Reset(c.errStream, c.errStream)
+		}
+		if err := c.configureLogger(); err != nil {
+			return err
+		}
+		if c.Config.Insecure {
+			c.logger.Warning("TLS certificate verification is disabled")
+		}
+		err := configureTransport(&transportConfig{
+			CABundle: c.Config.CABundle,
+			Insecure: c.Config.Insecure,
+			Timeout:  time.Duration(c.Config.RequestTimeout) * time.Second,
+			Retries:  c.Config.Retries,
+		})
+		if err != nil {
+			return err
+		}
+		if c.Config.SessionCache > 0 {
+			sessions.cache = NewSessionCache(c.logger, time.Duration(c.Config.SessionCache)*time.Minute)
+		}
+		return c.configureSOAPTrace()
+	}
+	installFlags := append([]cli.Flag{
+		cli.StringFlag{
+			Name:        "username, u",
+			Destination: &c.Config.Username,
+			EnvVar:      "SF_USERNAME",
+		},
+		cli.StringFlag{
+			Name:        "password, p",
+			Destination: &c.Config.Password,
+			EnvVar:      "SF_PASSWORD",
+		},
+		cli.StringFlag{
+			Name:        "endpoint, e",
+			Value:       "login.salesforce.com",
+			Destination: &c.Config.Endpoint,
+			EnvVar:      "SF_ENDPOINT",
+		},
+		cli.StringFlag{
+			Name:        "apiversion",
+			Value:       "38.0",
+			Destination: &c.Config.ApiVersion,
+			EnvVar:      "SF_APIVERSION",
+		},
+		cli.IntFlag{
+			Name:        "pollSeconds",
+			Value:       5,
+			Destination: &c.Config.PollSeconds,
+			EnvVar:      "SF_POLLSECONDS",
+		},
+		cli.IntFlag{
+			Name:        "timeoutSeconds",
+			Value:       0,
+			Destination: &c.Config.TimeoutSeconds,
+			EnvVar:      "SF_TIMEOUTSECONDS",
+		},
+		cli.StringFlag{
+			Name:        "packages, P",
+			Destination: &c.Config.PackageFile,
+		},
+		cli.StringFlag{
+			Name:        "org",
+			Usage:       "Org alias registered by `spm org add`",
+			Destination: &c.Config.Org,
+			EnvVar:      "SF_ORG",
+		},
+		cli.BoolFlag{
+			Name:        "clone-only",
+			Destination: &c.Config.IsCloneOnly,
+		},
+		cli.StringFlag{
+			Name:        "directory, d",
+			Destination: &c.Config.Directory,
+		},
+		cli.StringFlag{
+			Name:        "rules",
+			Usage:       "Migration rules file applied before deploy",
+			Destination: &c.Config.RulesFile,
+		},
+		cli.IntFlag{
+			Name:        "jobs, j",
+			Value:       1,
+			Usage:       "Number of packages downloaded and deployed concurrently",
+			Destination: &c.Config.Jobs,
+			EnvVar:      "SPM_JOBS",
+		},
+		cli.StringFlag{
+			Name:        "since",
+			Usage:       "Deploy only the components changed since the ref (branch, tag or commit) of the git repository",
+			Destination: &c.Config.Since,
+		},
+		cli.StringFlag{
+			Name:        "diff",
+			Usage:       "Deploy only the components changed between the refs of base..head of the git repository",
+			Destination: &c.Config.Diff,
+		},
+		cli.BoolFlag{
+			Name:        "dry-run",
+			Usage:       "Show the plan of the deploys without logging in to the org",
+			Destination: &c.Config.DryRun,
+		},
+		cli.StringFlag{
+			Name:        "out",
+			Usage:       "Directory to save the zips of --dry-run",
+			Destination: &c.Config.Out,
+		},
+		cli.StringFlag{
+			Name:        "vendor-dir",
+			Value:       VENDOR_DIR,
+			Usage:       "Directory of the packages vendored by `spm vendor`, used instead of cloning them",
+			Destination: &c.Config.VendorDir,
+			EnvVar:      "SPM_VENDOR_DIR",
+		},
+	}, c.oauthFlags()...)
 	app.Commands = []cli.Command{
 		{
 			Name:    "install",
 			Aliases: []string{"i"},
 			Usage:   "Install salesforce metadata on public remote repository(i.g. github) or salesforce org",
-			Flags: []cli.Flag{
+			Flags:   installFlags,
+			Action: func(ctx *cli.Context) error {
+				return c.runParallelInstaller(ctx, "install")
+			},
+		},
+		{
+			Name:  "validate",
+			Usage: "Validate deployment of salesforce metadata without saving it (check only)",
+			Flags: installFlags,
+			Action: func(ctx *cli.Context) error {
+				c.Config.CheckOnly = true
+				return c.runParallelInstaller(ctx, "validate")
+			},
+		},
+		{
+			Name:    "uninstall",
+			Aliases: []string{"u"},
+			Usage:   "Uninstall salesforce metadata on public remote repository(i.g. github) or salesforce org",
+			Flags: append([]cli.Flag{
 				cli.StringFlag{
 					Name:        "username, u",
 					Destination: &c.Config.Username,
@@ -91,46 +319,83 @@ func (c *CLI) Run(args []string) error {
 					Name:        "packages, P",
 					Destination: &c.Config.PackageFile,
 				},
+				cli.StringFlag{
+					Name:        "org",
+					Usage:       "Org alias registered by `spm org add`",
+					Destination: &c.Config.Org,
+					EnvVar:      "SF_ORG",
+				},
+				cli.StringFlag{
+					Name:        "destructive-timing",
+					Usage:       "pre or post to delete by destructiveChangesPre.xml or destructiveChangesPost.xml instead of destructiveChanges.xml",
+					Destination: &c.Config.DestructiveTiming,
+				},
 				cli.BoolFlag{
-					Name:        "clone-only",
-					Destination: &c.Config.IsCloneOnly,
+					Name:        "purge-on-delete",
+					Usage:       "Delete components immediately instead of moving them to the recycle bin (not available in production)",
+					Destination: &c.Config.PurgeOnDelete,
+				},
+				cli.BoolFlag{
+					Name:        "dry-run",
+					Usage:       "Show the plan of the deploys deleting the components without deploying",
+					Destination: &c.Config.DryRun,
 				},
 				cli.StringFlag{
-					Name:        "directory, d",
-					Destination: &c.Config.Directory,
+					Name:        "out",
+					Usage:       "Directory to save the zips of --dry-run",
+					Destination: &c.Config.Out,
+				},
+				cli.BoolFlag{
+					Name:        "cascade",
+					Usage:       "Uninstall the installed packages depending on the packages together",
+					Destination: &c.Config.Cascade,
 				},
+				cli.StringFlag{
+					Name:        "vendor-dir",
+					Value:       VENDOR_DIR,
+					Usage:       "Directory of the packages vendored by `spm vendor`, used instead of cloning them",
+					Destination: &c.Config.VendorDir,
+					EnvVar:      "SPM_VENDOR_DIR",
+				},
+			}, c.oauthFlags()...),
+			Action: func(ctx *cli.Context) error {
+				return c.runUninstaller(ctx)
 			},
+		},
+		{
+			Name:  "upgrade",
+			Usage: "Upgrade installed packages by deploying changed components and deleting removed ones",
+			Flags: append([]cli.Flag{
+				cli.BoolFlag{
+					Name:        "yes, y",
+					Usage:       "Apply the upgrade plan",
+					Destination: &c.Config.Yes,
+				},
+			}, installFlags...),
 			Action: func(ctx *cli.Context) error {
-				uris, err := loadInstallUrls(c.Config.PackageFile, ctx.Args().First())
-				if err != nil {
-					return err
-				}
-				if len(uris) == 0 {
-					err = errors.New("Repository not specified")
-					return err
-				}
-				for _, uri := range uris {
-					downloader, err := dispatchDownloader(c.logger, uri)
-					if err != nil {
-						return err
-					}
-
-					installer, err := NewSalesforceInstaller(c.logger, downloader, c.Config, uri)
-					if err != nil {
-						return err
-					}
-					if err = installer.Install(); err != nil {
-						return err
-					}
-				}
-				return err
+				return c.runUpgrader(ctx)
 			},
 		},
 		{
-			Name:    "uninstall",
-			Aliases: []string{"u"},
-			Usage:   "Uninstall salesforce metadata on public remote repository(i.g. github) or salesforce org",
-			Flags: []cli.Flag{
+			Name:      "pack",
+			Usage:     "Build an artifact of the packages and their dependencies to deploy later by spm deploy",
+			ArgsUsage: "<source>",
+			Flags: append([]cli.Flag{
+				cli.StringFlag{
+					Name:  "output, o",
+					Value: "artifact.zip",
+					Usage: "Artifact file to write",
+				},
+			}, installFlags...),
+			Action: func(ctx *cli.Context) error {
+				return c.pack(ctx)
+			},
+		},
+		{
+			Name:      "deploy",
+			Usage:     "Deploy an artifact built by spm pack",
+			ArgsUsage: "<artifact>",
+			Flags: append([]cli.Flag{
 				cli.StringFlag{
 					Name:        "username, u",
 					Destination: &c.Config.Username,
@@ -165,35 +430,51 @@ func (c *CLI) Run(args []string) error {
 					Destination: &c.Config.TimeoutSeconds,
 					EnvVar:      "SF_TIMEOUTSECONDS",
 				},
+				cli.StringFlag{
+					Name:        "org",
+					Usage:       "Org alias registered by `spm org add`",
+					Destination: &c.Config.Org,
+					EnvVar:      "SF_ORG",
+				},
+				cli.BoolFlag{
+					Name:        "check-only",
+					Usage:       "Validate the deployment without saving it",
+					Destination: &c.Config.CheckOnly,
+				},
+				cli.BoolFlag{
+					Name:        "dry-run",
+					Usage:       "Show the plan of the deploys without logging in to the org",
+					Destination: &c.Config.DryRun,
+				},
+				cli.StringFlag{
+					Name:        "out",
+					Usage:       "Directory to save the zips of --dry-run",
+					Destination: &c.Config.Out,
+				},
+			}, c.oauthFlags()...),
+			Action: func(ctx *cli.Context) error {
+				return c.deploy(ctx)
+			},
+		},
+		{
+			Name:      "vendor",
+			Usage:     "Download the packages and their dependencies to the vendor directory for installs without network access to git hosts",
+			ArgsUsage: "<source>",
+			Flags: []cli.Flag{
 				cli.StringFlag{
 					Name:        "packages, P",
 					Destination: &c.Config.PackageFile,
 				},
+				cli.StringFlag{
+					Name:        "vendor-dir",
+					Value:       VENDOR_DIR,
+					Usage:       "Directory to write the packages and " + VENDOR_LOCK,
+					Destination: &c.Config.VendorDir,
+					EnvVar:      "SPM_VENDOR_DIR",
+				},
 			},
 			Action: func(ctx *cli.Context) error {
-				uris, err := loadInstallUrls(c.Config.PackageFile, ctx.Args().First())
-				if err != nil {
-					return err
-				}
-				if len(uris) == 0 {
-					err = errors.New("Repository not specified")
-					return err
-				}
-				for _, uri := range uris {
-					downloader, err := dispatchDownloader(c.logger, uri)
-					if err != nil {
-						return err
-					}
-
-					installer, err := NewSalesforceInstaller(c.logger, downloader, c.Config, uri)
-					if err != nil {
-						return err
-					}
-					if err = installer.Uninstall(); err != nil {
-						return err
-					}
-				}
-				return err
+				return c.vendor(ctx)
 			},
 		},
 		{
@@ -229,31 +510,824 @@ func (c *CLI) Run(args []string) error {
 					Value:       "tmp",
 					Destination: &c.Config.Directory,
 				},
+				cli.StringSliceFlag{
+					Name:  "package-name",
+					Usage: "Name of unmanaged or managed package to retrieve",
+				},
+				cli.StringSliceFlag{
+					Name:  "file",
+					Usage: "Specific file path to retrieve (i.g. classes/Hoge.cls)",
+				},
+				cli.BoolFlag{
+					Name:  "normalize",
+					Usage: "Sort elements, remove volatile elements and indent xml files for stable diffs",
+				},
+				cli.StringFlag{
+					Name:        "org",
+					Usage:       "Org alias registered by `spm org add`",
+					Destination: &c.Config.Org,
+					EnvVar:      "SF_ORG",
+				},
 			},
 			Action: func(ctx *cli.Context) error {
-				uri, err := convertToUrl(ctx.Args().First())
-				if err != nil {
-					return err
-				}
-				downloader, err := dispatchDownloader(c.logger, uri)
-				if err != nil {
-					return err
+				c.report = NewCommandReport("clone")
+				target := ctx.Args().First()
+				if target == "" && c.Config.Org != "" {
+					target = fmt.Sprintf("sf://@%s", c.Config.Org)
 				}
-				files, err := downloader.Download()
+				uri, err := convertToUrl(target)
 				if err != nil {
 					return err
 				}
-				if _, ok := downloader.(*SalesforceDownloader); ok {
-					err = unzip(files[0].Body, c.Config.Directory)
+				result := NewPackageResult(uri)
+				err = c.clone(ctx, uri, result)
+				result.Finish(err)
+				c.report.Add(result)
+				return err
+			},
+		},
+		{
+			Name:      "status",
+			Usage:     "Check status of the deployment",
+			ArgsUsage: "<deployId>",
+			Flags: append([]cli.Flag{
+				cli.StringFlag{
+					Name:        "username, u",
+					Destination: &c.Config.Username,
+					EnvVar:      "SF_USERNAME",
+				},
+				cli.StringFlag{
+					Name:        "password, p",
+					Destination: &c.Config.Password,
+					EnvVar:      "SF_PASSWORD",
+				},
+				cli.StringFlag{
+					Name:        "endpoint, e",
+					Value:       "login.salesforce.com",
+					Destination: &c.Config.Endpoint,
+					EnvVar:      "SF_ENDPOINT",
+				},
+				cli.StringFlag{
+					Name:        "apiversion",
+					Value:       "38.0",
+					Destination: &c.Config.ApiVersion,
+					EnvVar:      "SF_APIVERSION",
+				},
+				cli.StringFlag{
+					Name:        "org",
+					Usage:       "Org alias registered by `spm org add`",
+					Destination: &c.Config.Org,
+					EnvVar:      "SF_ORG",
+				},
+			}, c.oauthFlags()...),
+			Action: func(ctx *cli.Context) error {
+				c.report = NewCommandReport("status")
+				id := ctx.Args().First()
+				if id == "" {
+					return errors.New("Deploy ID not specified")
 				}
+				result := NewPackageResult("")
+				result.DeployId = id
+				err := c.status(id, result)
+				result.Finish(err)
+				c.report.Add(result)
 				return err
 			},
 		},
+		{
+			Name:      "diff",
+			Usage:     "Compare the components of a package with the ones in the org",
+			ArgsUsage: "[repository]",
+			Flags: append([]cli.Flag{
+				cli.StringFlag{
+					Name:        "username, u",
+					Destination: &c.Config.Username,
+					EnvVar:      "SF_USERNAME",
+				},
+				cli.StringFlag{
+					Name:        "password, p",
+					Destination: &c.Config.Password,
+					EnvVar:      "SF_PASSWORD",
+				},
+				cli.StringFlag{
+					Name:        "endpoint, e",
+					Value:       "login.salesforce.com",
+					Destination: &c.Config.Endpoint,
+					EnvVar:      "SF_ENDPOINT",
+				},
+				cli.StringFlag{
+					Name:        "apiversion",
+					Value:       "38.0",
+					Destination: &c.Config.ApiVersion,
+					EnvVar:      "SF_APIVERSION",
+				},
+				cli.StringFlag{
+					Name:        "packages, P",
+					Destination: &c.Config.PackageFile,
+				},
+				cli.StringFlag{
+					Name:        "org",
+					Usage:       "Org alias registered by `spm org add`",
+					Destination: &c.Config.Org,
+					EnvVar:      "SF_ORG",
+				},
+				cli.StringFlag{
+					Name:        "vendor-dir",
+					Value:       VENDOR_DIR,
+					Usage:       "Directory of the packages vendored by `spm vendor`, used instead of cloning them",
+					Destination: &c.Config.VendorDir,
+					EnvVar:      "SPM_VENDOR_DIR",
+				},
+			}, c.oauthFlags()...),
+			Action: func(ctx *cli.Context) error {
+				return c.diff(ctx)
+			},
+		},
+		{
+			Name:      "compare",
+			Usage:     "Compare the components of the manifest between two orgs",
+			ArgsUsage: "<source sf:// URI> <target sf:// URI>",
+			Flags: []cli.Flag{
+				cli.StringFlag{
+					Name:  "format, f",
+					Value: "text",
+					Usage: "text, json or html",
+				},
+				cli.StringFlag{
+					Name:  "output, o",
+					Usage: "Write the json or html comparison to the file instead of stdout",
+				},
+			},
+			Action: func(ctx *cli.Context) error {
+				return c.compare(ctx)
+			},
+		},
+		{
+			Name:  "installed",
+			Usage: "List packages installed by spm in the org",
+			Flags: append([]cli.Flag{
+				cli.StringFlag{
+					Name:        "username, u",
+					Destination: &c.Config.Username,
+					EnvVar:      "SF_USERNAME",
+				},
+				cli.StringFlag{
+					Name:        "password, p",
+					Destination: &c.Config.Password,
+					EnvVar:      "SF_PASSWORD",
+				},
+				cli.StringFlag{
+					Name:        "endpoint, e",
+					Value:       "login.salesforce.com",
+					Destination: &c.Config.Endpoint,
+					EnvVar:      "SF_ENDPOINT",
+				},
+				cli.StringFlag{
+					Name:        "apiversion",
+					Value:       "38.0",
+					Destination: &c.Config.ApiVersion,
+					EnvVar:      "SF_APIVERSION",
+				},
+				cli.StringFlag{
+					Name:        "org",
+					Usage:       "Org alias registered by `spm org add`",
+					Destination: &c.Config.Org,
+					EnvVar:      "SF_ORG",
+				},
+			}, c.oauthFlags()...),
+			Action: func(ctx *cli.Context) error {
+				return c.installed()
+			},
+		},
+		{
+			Name:  "mock-server",
+			Usage: "Run fake Metadata API server for offline testing",
+			Flags: []cli.Flag{
+				cli.StringFlag{
+					Name:  "listen, l",
+					Value: "127.0.0.1:8080",
+					Usage: "Address to listen on",
+				},
+				cli.StringFlag{
+					Name:  "scenario, s",
+					Usage: "Scenario file injecting faults, component failures, test failures and slow deploys",
+				},
+			},
+			Action: func(ctx *cli.Context) error {
+				var scenario *MockScenario
+				if file := ctx.String("scenario"); file != "" {
+					var err error
+					if scenario, err = readMockScenario(file); err != nil {
+						return err
+					}
+				}
+				addr := ctx.String("listen")
+				c.logger.Infof("Mock server is listening on %s. Use --endpoint http://%s", addr, addr)
+				return http.ListenAndServe(addr, NewMockServer(c.logger, scenario))
+			},
+		},
+		{
+			Name:  "org",
+			Usage: "Manage org aliases stored in ~/.spm/orgs.toml",
+			Subcommands: []cli.Command{
+				{
+					Name:      "add",
+					Usage:     "Add or update org alias",
+					ArgsUsage: "<alias>",
+					Flags: []cli.Flag{
+						cli.StringFlag{
+							Name:  "endpoint, e",
+							Value: "login.salesforce.com",
+						},
+						cli.StringFlag{
+							Name:  "auth",
+							Value: AUTH_PASSWORD,
+							Usage: "password, jwt, refresh_token or access_token",
+						},
+						cli.StringFlag{
+							Name: "username, u",
+						},
+						cli.StringFlag{
+							Name: "apiversion",
+						},
+						cli.StringFlag{
+							Name: "client-id",
+						},
+						cli.StringFlag{
+							Name: "jwt-key",
+						},
+						cli.StringFlag{
+							Name: "token-endpoint",
+						},
+						cli.StringFlag{
+							Name: "instance-url",
+						},
+						cli.StringFlag{
+							Name:  "password-env",
+							Usage: "Environment variable holding the password or token",
+						},
+						cli.StringFlag{
+							Name:  "password-command",
+							Usage: "Command printing the password or token",
+						},
+						cli.BoolFlag{
+							Name:  "store",
+							Usage: "Store the password or token in the encrypted secret store",
+						},
+					},
+					Action: func(ctx *cli.Context) error {
+						alias := ctx.Args().First()
+						if alias == "" {
+							return errors.New("Org alias not specified")
+						}
+						org := &OrgProfile{
+							Endpoint:        ctx.String("endpoint"),
+							Auth:            ctx.String("auth"),
+							Username:        ctx.String("username"),
+							ApiVersion:      ctx.String("apiversion"),
+							ClientId:        ctx.String("client-id"),
+							JwtKeyFile:      ctx.String("jwt-key"),
+							TokenEndpoint:   ctx.String("token-endpoint"),
+							InstanceUrl:     ctx.String("instance-url"),
+							PasswordEnv:     ctx.String("password-env"),
+							PasswordCommand: ctx.String("password-command"),
+						}
+						secret := ""
+						if ctx.Bool("store") {
+							secret = os.Getenv("SPM_SECRET")
+							if secret == "" {
+								var err error
+								if secret, err = promptSecret(fmt.Sprintf("Password or token for %s: ", alias)); err != nil {
+									return err
+								}
+							}
+						}
+						if err := addOrg(alias, org, secret); err != nil {
+							return err
+						}
+						c.logger.Infof("Org %s is added", alias)
+						return nil
+					},
+				},
+				{
+					Name:  "list",
+					Usage: "List org aliases",
+					Action: func(ctx *cli.Context) error {
+						orgs, err := readOrgsFile()
+						if err != nil {
+							return err
+						}
+						for _, alias := range orgs.Aliases() {
+							org := orgs.Orgs[alias]
+							c.logger.Infof("%s: %s@%s (auth: %s)", alias, org.Username, org.Endpoint, org.Auth)
+						}
+						return nil
+					},
+				},
+				{
+					Name:      "remove",
+					Usage:     "Remove org alias and its stored secret",
+					ArgsUsage: "<alias>",
+					Action: func(ctx *cli.Context) error {
+						alias := ctx.Args().First()
+						if err := removeOrg(alias); err != nil {
+							return err
+						}
+						c.logger.Infof("Org %s is removed", alias)
+						return nil
+					},
+				},
+				{
+					Name:      "login",
+					Usage:     "Check login to org alias",
+					ArgsUsage: "<alias>",
+					Action: func(ctx *cli.Context) error {
+						alias := ctx.Args().First()
+						config := &config{Endpoint: "login.salesforce.com", ApiVersion: DEFAULT_API_VERSION}
+						if err := config.applyOrg(alias); err != nil {
+							return err
+						}
+						if err := config.validate("Org"); err != nil {
+							return err
+						}
+						client := NewForceClient(config.Endpoint, config.ApiVersion)
+						client.SetLogger(c.logger)
+						if err := config.login(client); err != nil {
+							return err
+						}
+						c.logger.Infof("%s: Login is successful (%s)", alias, client.loginResult.MetadataServerUrl)
+						return nil
+					},
+				},
+			},
+		},
 	}
 
 	err := app.Run(args)
 	if err != nil {
 		c.logger.Error(err)
 	}
+	if c.logFile != nil {
+		c.logFile.Close()
+	}
+	if c.replayListener != nil {
+		c.replayListener.Close()
+	}
+	if c.Config.Json && c.report != nil {
+		c.report.Finish(err)
+		if werr := c.report.Write(c.outStream); werr != nil {
+			c.logger.Error(werr)
+		}
+	}
 	return err
 }
+
+func (c *CLI) configureLogger() error {
+	level := c.Config.LogLevel
+	if c.Config.Verbose || c.Config.Quiet {
+		if level != "" || (c.Config.Verbose && c.Config.Quiet) {
+			return errors.New("--verbose, --quiet and --log-level can not be used at the same time")
+		}
+		level = "debug"
+		if c.Config.Quiet {
+			level = "warning"
+		}
+	}
+	if level != "" {
+		if err := c.logger.SetLevel(level); err != nil {
+			return err
+		}
+	}
+	if c.Config.LogFile != "" {
+		f, err := os.OpenFile(c.Config.LogFile, os.O_WRONLY|os.O_CREATE|os.O_APPEND, 0600)
+		if err != nil {
+			return err
+		}
+		c.logFile = f
+		c.logger.SetLogFile(f)
+	}
+	return c.logger.SetFormat(c.Config.LogFormat)
+}
+
+func (c *CLI) configureSOAPTrace() error {
+	if c.Config.TraceSOAP != "" && c.Config.ReplaySOAP != "" {
+		return errors.New("--trace-soap and --replay-soap can not be used at the same time")
+	}
+	if c.Config.TraceSOAP != "" {
+		recorder, err := NewSOAPRecorder(c.Config.TraceSOAP)
+		if err != nil {
+			return err
+		}
+		soapRecorder = recorder
+	}
+	if c.Config.ReplaySOAP != "" {
+		l, err := startSOAPReplay(c.Config.ReplaySOAP)
+		if err != nil {
+			return err
+		}
+		c.replayListener = l
+		c.logger.Warningf("SOAP requests are answered by recordings in %s", c.Config.ReplaySOAP)
+	}
+	return nil
+}
+
+// runUninstaller uninstalls the packages, and the packages depending on them with --cascade,
+// in reverse dependency order recorded in the registry of the org.
+func (c *CLI) runUninstaller(ctx *cli.Context) error {
+	c.report = NewCommandReport("uninstall")
+	uris, err := c.installUrls(ctx)
+	if err != nil {
+		return err
+	}
+	newDownloader, err := c.newDownloader()
+	if err != nil {
+		return err
+	}
+	registry, err := c.readRegistry("Uninstaller")
+	if err != nil {
+		return err
+	}
+	ordered, err := registry.UninstallOrder(uris, c.Config.Cascade)
+	if err != nil {
+		return err
+	}
+	if len(ordered) > len(uris) {
+		c.logger.Infof("Uninstall order: %s", strings.Join(ordered, ", "))
+	}
+	for _, uri := range ordered {
+		downloader, err := newDownloader(c.logger, uri)
+		if err != nil {
+			return err
+		}
+		installer, err := NewSalesforceInstaller(c.logger, downloader, c.Config, uri)
+		if err != nil {
+			return err
+		}
+		installer.report = c.report
+		installer.registry = registry
+		if err = installer.Uninstall(); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// runUpgrader shows the plans to upgrade the packages from the commits recorded in the registry of the org,
+// and applies them with --yes.
+func (c *CLI) runUpgrader(ctx *cli.Context) error {
+	c.report = NewCommandReport("upgrade")
+	uris, err := c.installUrls(ctx)
+	if err != nil {
+		return err
+	}
+	newDownloader, err := c.newDownloader()
+	if err != nil {
+		return err
+	}
+	registry, err := c.readRegistry("Upgrader")
+	if err != nil {
+		return err
+	}
+	for _, uri := range uris {
+		downloader, err := newDownloader(c.logger, uri)
+		if err != nil {
+			return err
+		}
+		installer, err := NewSalesforceInstaller(c.logger, downloader, c.Config, uri)
+		if err != nil {
+			return err
+		}
+		installer.report = c.report
+		installer.registry = registry
+		if err = installer.Upgrade(); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// diff compares the packages with the components in the org.
+func (c *CLI) diff(ctx *cli.Context) error {
+	c.report = NewCommandReport("diff")
+	uris, err := c.installUrls(ctx)
+	if err != nil {
+		return err
+	}
+	newDownloader, err := c.newDownloader()
+	if err != nil {
+		return err
+	}
+	for _, uri := range uris {
+		downloader, err := newDownloader(c.logger, uri)
+		if err != nil {
+			return err
+		}
+		installer, err := NewSalesforceInstaller(c.logger, downloader, c.Config, uri)
+		if err != nil {
+			return err
+		}
+		installer.report = c.report
+		if err = installer.Diff(); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// compare compares the components retrieved from the two orgs of the arguments.
+func (c *CLI) compare(ctx *cli.Context) error {
+	c.report = NewCommandReport("compare")
+	if ctx.NArg() != 2 {
+		return errors.New("Source and target orgs are required")
+	}
+	format := ctx.String("format")
+	if format != "text" && format != "json" && format != "html" {
+		return fmt.Errorf("Invalid format: %s", format)
+	}
+	if c.Config.Json && format != "text" && ctx.String("output") == "" {
+		// the report of --json includes the comparison, so another document on stdout would break it
+		return fmt.Errorf("--json and --format %s cannot be used together without --output", format)
+	}
+	comparison, err := compareOrgs(c.logger, ctx.Args().Get(0), ctx.Args().Get(1))
+	if err != nil {
+		return err
+	}
+	c.report.Comparison = comparison
+	if format == "text" {
+		comparison.Log(c.logger)
+		return nil
+	}
+	w := c.outStream
+	if file := ctx.String("output"); file != "" {
+		f, err := os.Create(file)
+		if err != nil {
+			return err
+		}
+		defer f.Close()
+		w = f
+	}
+	if format == "json" {
+		return comparison.WriteJSON(w)
+	}
+	return comparison.WriteHTML(w)
+}
+
+// pack downloads the packages and their dependencies, converts them and writes the artifact to --output.
+func (c *CLI) pack(ctx *cli.Context) error {
+	c.report = NewCommandReport("pack")
+	uris, err := c.installUrls(ctx)
+	if err != nil {
+		return err
+	}
+	if c.Config.Directory == "" {
+		c.Config.Directory = os.TempDir()
+	}
+	c.Config.IsPackOnly = true
+	artifact := NewArtifact()
+	installer, err := c.newParallelInstaller()
+	if err != nil {
+		return err
+	}
+	installer.artifact = artifact
+	if err = installer.Install(uris); err != nil {
+		return err
+	}
+	output := ctx.String("output")
+	if err = artifact.Write(output); err != nil {
+		return err
+	}
+	c.logger.Infof("Artifact of %d packages is written to %s", len(artifact.Packages), output)
+	return nil
+}
+
+// deploy deploys the packages of the artifact built by pack.
+func (c *CLI) deploy(ctx *cli.Context) error {
+	c.report = NewCommandReport("deploy")
+	path := ctx.Args().First()
+	if path == "" {
+		return errors.New("Artifact not specified")
+	}
+	if c.Config.Org != "" {
+		if err := c.Config.applyOrg(c.Config.Org); err != nil {
+			return err
+		}
+	}
+	return deployArtifact(c.logger, c.Config, c.report, path)
+}
+
+// readRegistry logs in the org and reads the packages installed by spm.
+func (c *CLI) readRegistry(name string) (*Registry, error) {
+	if err := c.Config.validate(name); err != nil {
+		return nil, err
+	}
+	client := NewForceClient(c.Config.Endpoint, c.Config.ApiVersion)
+	client.SetLogger(c.logger)
+	client.SetPolling(c.Config.PollSeconds, c.Config.TimeoutSeconds)
+	if err := c.Config.login(client); err != nil {
+		return nil, err
+	}
+	return readRegistry(client)
+}
+
+// installed lists the packages recorded in the registry of the org.
+func (c *CLI) installed() error {
+	c.report = NewCommandReport("installed")
+	if c.Config.Org != "" {
+		if err := c.Config.applyOrg(c.Config.Org); err != nil {
+			return err
+		}
+	}
+	registry, err := c.readRegistry("Installed")
+	if err != nil {
+		return err
+	}
+	c.report.Installed = registry.List()
+	for _, p := range c.report.Installed {
+		c.logger.Infof("%s (ref: %s, commit: %s, installed at %s by spm %s)", p.URI, p.Ref, p.Commit, p.InstalledAt.Format(time.RFC3339), p.SpmVersion)
+	}
+	if len(c.report.Installed) == 0 {
+		c.logger.Info("No packages are installed by spm")
+	}
+	return nil
+}
+
+// runParallelInstaller installs or validates the packages and their dependencies by --jobs concurrent jobs.
+func (c *CLI) runParallelInstaller(ctx *cli.Context, command string) error {
+	c.report = NewCommandReport(command)
+	uris, err := c.installUrls(ctx)
+	if err != nil {
+		return err
+	}
+	// set before installers run concurrently, since they share the config
+	if c.Config.Directory == "" {
+		c.Config.Directory = os.TempDir()
+	}
+	installer, err := c.newParallelInstaller()
+	if err != nil {
+		return err
+	}
+	return installer.Install(uris)
+}
+
+// newParallelInstaller returns the installer reading the packages vendored in --vendor-dir instead of cloning them.
+func (c *CLI) newParallelInstaller() (*ParallelInstaller, error) {
+	installer := NewParallelInstaller(c.logger, c.Config, c.report, c.Config.Jobs)
+	newDownloader, err := c.newDownloader()
+	if err != nil {
+		return nil, err
+	}
+	installer.newDownloader = newDownloader
+	return installer, nil
+}
+
+// newDownloader returns the function creating the downloaders of the packages vendored in --vendor-dir,
+// or dispatchDownloader if the directory is not vendored.
+func (c *CLI) newDownloader() (func(logger Logger, uri string) (Downloader, error), error) {
+	if c.Config.VendorDir == "" {
+		return dispatchDownloader, nil
+	}
+	lock, err := readVendorLock(c.Config.VendorDir)
+	if err != nil {
+		return nil, err
+	}
+	if lock == nil {
+		return dispatchDownloader, nil
+	}
+	c.logger.Infof("Use packages vendored in %s", c.Config.VendorDir)
+	return lock.downloader, nil
+}
+
+// vendor writes the packages and their dependencies to --vendor-dir.
+func (c *CLI) vendor(ctx *cli.Context) error {
+	c.report = NewCommandReport("vendor")
+	uris, err := c.installUrls(ctx)
+	if err != nil {
+		return err
+	}
+	lock, err := vendor(c.logger, uris, c.Config.VendorDir, dispatchDownloader)
+	if err != nil {
+		return err
+	}
+	c.logger.Infof("%d packages are vendored in %s", len(lock.Packages), c.Config.VendorDir)
+	return nil
+}
+
+func (c *CLI) installUrls(ctx *cli.Context) ([]string, error) {
+	if c.Config.Org != "" {
+		if err := c.Config.applyOrg(c.Config.Org); err != nil {
+			return nil, err
+		}
+	}
+	uris, err := loadInstallUrls(c.Config.PackageFile, ctx.Args().First())
+	if err != nil {
+		return nil, err
+	}
+	if len(uris) == 0 {
+		return nil, errors.New("Repository not specified")
+	}
+	return uris, nil
+}
+
+func (c *CLI) clone(ctx *cli.Context, uri string, result *PackageResult) error {
+	downloader, err := dispatchDownloader(c.logger, uri)
+	if err != nil {
+		return err
+	}
+	if sd, ok := downloader.(*SalesforceDownloader); ok {
+		sd.config.packageNames = ctx.StringSlice("package-name")
+		sd.config.specificFiles = ctx.StringSlice("file")
+		sd.client.SetPolling(c.Config.PollSeconds, c.Config.TimeoutSeconds)
+	}
+	files, err := downloader.Download()
+	if err != nil {
+		return &DownloadError{err}
+	}
+	if gd, ok := downloader.(*GitDownloader); ok {
+		result.Commit = gd.commit
+	}
+	if _, ok := downloader.(*SalesforceDownloader); ok {
+		if ctx.Bool("normalize") {
+			err = unzipNormalized(files[0].Body, c.Config.Directory)
+		} else {
+			err = unzip(files[0].Body, c.Config.Directory)
+		}
+		result.Directory = c.Config.Directory
+	}
+	return err
+}
+
+func (c *CLI) status(id string, result *PackageResult) error {
+	if c.Config.Org != "" {
+		if err := c.Config.applyOrg(c.Config.Org); err != nil {
+			return err
+		}
+	}
+	if err := c.Config.validate("Status"); err != nil {
+		return err
+	}
+	client := NewForceClient(c.Config.Endpoint, c.Config.ApiVersion)
+	client.SetLogger(c.logger)
+	if err := c.Config.login(client); err != nil {
+		return err
+	}
+	deployId := ID(id)
+	response, err := client.CheckDeployStatus(&deployId)
+	if err != nil {
+		return err
+	}
+	r := response.Result
+	result.SetDeployResult(r)
+	if r.Done && !r.Success {
+		return newDeployResultError(id, r)
+	}
+	c.logger.Infof("%s: %s (components: %d/%d, tests: %d/%d)", id, result.Status,
+		r.NumberComponentsDeployed, r.NumberComponentsTotal, r.NumberTestsCompleted, r.NumberTestsTotal)
+	return nil
+}
+
+func (c *CLI) oauthFlags() []cli.Flag {
+	return []cli.Flag{
+		cli.StringFlag{
+			Name:        "access-token",
+			Usage:       "Existing session ID or OAuth access token",
+			Destination: &c.Config.AccessToken,
+			EnvVar:      "SF_ACCESS_TOKEN",
+		},
+		cli.StringFlag{
+			Name:        "instance-url",
+			Usage:       "Instance URL for the access token (i.g. https://na1.salesforce.com)",
+			Destination: &c.Config.InstanceUrl,
+			EnvVar:      "SF_INSTANCE_URL",
+		},
+		cli.StringFlag{
+			Name:        "client-id",
+			Usage:       "Consumer key of the connected app",
+			Destination: &c.Config.ClientId,
+			EnvVar:      "SF_CLIENT_ID",
+		},
+		cli.StringFlag{
+			Name:        "client-secret",
+			Usage:       "Consumer secret of the connected app",
+			Destination: &c.Config.ClientSecret,
+			EnvVar:      "SF_CLIENT_SECRET",
+		},
+		cli.StringFlag{
+			Name:        "refresh-token",
+			Usage:       "Refresh token for OAuth 2.0 refresh token flow",
+			Destination: &c.Config.RefreshToken,
+			EnvVar:      "SF_REFRESH_TOKEN",
+		},
+		cli.StringFlag{
+			Name:        "jwt-key",
+			Usage:       "Private key file for OAuth 2.0 JWT bearer flow",
+			Destination: &c.Config.JwtKeyFile,
+			EnvVar:      "SF_JWT_KEY",
+		},
+		cli.StringFlag{
+			Name:        "token-endpoint",
+			Usage:       "OAuth 2.0 token endpoint (default: https://{endpoint}/services/oauth2/token)",
+			Destination: &c.Config.TokenEndpoint,
+			EnvVar:      "SF_TOKEN_ENDPOINT",
+		},
+	}
+}
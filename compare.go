@@ -0,0 +1,125 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"html/template"
+	"io"
+	"strings"
+	"sync"
+)
+
+// Comparison is the component-level comparison of the manifest retrieved from two orgs.
+// Components are missing if in the source org only, and extra if in the target org only.
+type Comparison struct {
+	Source     string           `json:"source"`
+	Target     string           `json:"target"`
+	Components []*ComponentDiff `json:"components"`
+	Summary    map[string]int   `json:"summary"`
+}
+
+// compareOrgs retrieves the manifests of the sf:// URIs concurrently and compares the components.
+func compareOrgs(logger Logger, source string, target string) (*Comparison, error) {
+	uris := []string{source, target}
+	files := make([][]*File, len(uris))
+	errs := make([]error, len(uris))
+	var wg sync.WaitGroup
+	for n, uri := range uris {
+		wg.Add(1)
+		go func(n int, uri string) {
+			defer wg.Done()
+			files[n], errs[n] = retrieveOrg(logger, uri)
+		}(n, uri)
+	}
+	wg.Wait()
+	for _, err := range errs {
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	c := &componentComparer{source: "source", target: "target", normalize: normalizeOrgSource}
+	components, skipped := c.compare(files[0], files[1])
+	for _, name := range skipped {
+		logger.Warningf("%s is not compared. The metadata type of the file is unknown. List it in the manifest", name)
+	}
+	comparison := &Comparison{
+		Source:     redact(source),
+		Target:     redact(target),
+		Components: components,
+		Summary:    map[string]int{DIFF_IDENTICAL: 0, DIFF_CHANGED: 0, DIFF_MISSING: 0, DIFF_EXTRA: 0},
+	}
+	for _, d := range comparison.Components {
+		comparison.Summary[d.Status]++
+	}
+	return comparison, nil
+}
+
+func retrieveOrg(logger Logger, uri string) ([]*File, error) {
+	if !strings.HasPrefix(uri, "sf://") {
+		return nil, fmt.Errorf("%s is not an org. Use sf:// URI", redact(uri))
+	}
+	downloader, err := dispatchDownloader(logger, uri)
+	if err != nil {
+		return nil, err
+	}
+	files, err := downloader.Download()
+	if err != nil {
+		return nil, &DownloadError{err}
+	}
+	if isZipped(files) {
+		return unzipFiles(files[0].Body)
+	}
+	return files, nil
+}
+
+// Log writes the comparison as text.
+func (c *Comparison) Log(logger Logger) {
+	for _, d := range c.Components {
+		logger.Infof("  %-9s %s %s", d.Status, d.Type, d.Member)
+		if d.Diff != "" {
+			logger.Info(d.Diff)
+		}
+	}
+	logger.Infof("%s -> %s: %d identical, %d changed, %d missing in the target, %d extra in the target",
+		c.Source, c.Target, c.Summary[DIFF_IDENTICAL], c.Summary[DIFF_CHANGED], c.Summary[DIFF_MISSING], c.Summary[DIFF_EXTRA])
+}
+
+func (c *Comparison) WriteJSON(w io.Writer) error {
+	encoder := json.NewEncoder(w)
+	encoder.SetIndent("", "  ")
+	return encoder.Encode(c)
+}
+
+var comparisonTemplate = template.Must(template.New("comparison").Parse(`<!DOCTYPE html>
+<html>
+<head>
+<meta charset="utf-8">
+<title>spm compare</title>
+<style>
+body { font-family: sans-serif; }
+table { border-collapse: collapse; }
+th, td { border: 1px solid #ccc; padding: 4px 8px; text-align: left; }
+.identical { color: #888; }
+.changed { background: #fff8dc; }
+.missing { background: #e6ffed; }
+.extra { background: #ffeef0; }
+pre { background: #f6f8fa; padding: 8px; overflow: auto; }
+</style>
+</head>
+<body>
+<h1>{{.Source}} &rarr; {{.Target}}</h1>
+<p>{{index .Summary "identical"}} identical, {{index .Summary "changed"}} changed, {{index .Summary "missing"}} missing in the target, {{index .Summary "extra"}} extra in the target</p>
+<table>
+<tr><th>Type</th><th>Member</th><th>Status</th></tr>
+{{range .Components}}<tr class="{{.Status}}"><td>{{.Type}}</td><td>{{.Member}}</td><td>{{.Status}}</td></tr>
+{{end}}</table>
+{{range .Components}}{{if .Diff}}<h2>{{.Type}} {{.Member}}</h2>
+<pre>{{.Diff}}</pre>
+{{end}}{{end}}</body>
+</html>
+`))
+
+func (c *Comparison) WriteHTML(w io.Writer) error {
+	return comparisonTemplate.Execute(w, c)
+}
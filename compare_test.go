@@ -0,0 +1,88 @@
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestCompareOrgs(t *testing.T) {
+	defer func(tr http.RoundTripper, retries int) {
+		sharedTransport = tr
+		defaultRetryPolicy.MaxRetries = retries
+	}(sharedTransport, defaultRetryPolicy.MaxRetries)
+	assert.Nil(t, configureTransport(&transportConfig{Insecure: true}))
+
+	source := httptest.NewTLSServer(NewMockServer(NewSpmLogger(ioutil.Discard, ioutil.Discard), nil))
+	defer source.Close()
+	target := httptest.NewTLSServer(NewMockServer(NewSpmLogger(ioutil.Discard, ioutil.Discard), nil))
+	defer target.Close()
+
+	assert.Nil(t, newMockInstaller(t, source.URL, []*File{
+		{Name: "unpackaged/package.xml", Body: newPackageXML([]*component{{Type: "ApexClass", Member: "*"}}, "38.0").Bytes()},
+		{Name: "unpackaged/classes/Hoge.cls", Body: []byte("public class Hoge { Integer i; }")},
+		{Name: "unpackaged/classes/Hoge.cls-meta.xml", Body: []byte("<?xml version=\"1.0\" encoding=\"UTF-8\"?>\n<ApexClass>\n    <apiVersion>41.0</apiVersion>\n</ApexClass>\n")},
+		{Name: "unpackaged/classes/Fuga.cls", Body: []byte("public class Fuga {}")},
+		{Name: "unpackaged/classes/Fuga.cls-meta.xml", Body: []byte("<?xml version=\"1.0\" encoding=\"UTF-8\"?>\n<ApexClass>\n    <apiVersion>41.0</apiVersion>\n</ApexClass>\n")},
+	}).Install())
+	assert.Nil(t, newMockInstaller(t, target.URL, []*File{
+		{Name: "unpackaged/package.xml", Body: newPackageXML([]*component{{Type: "ApexClass", Member: "*"}}, "38.0").Bytes()},
+		{Name: "unpackaged/classes/Hoge.cls", Body: []byte("public class Hoge {}")},
+		{Name: "unpackaged/classes/Hoge.cls-meta.xml", Body: []byte("<?xml version=\"1.0\" encoding=\"UTF-8\"?>\n<ApexClass>\n    <apiVersion>38.0</apiVersion>\n</ApexClass>\n")},
+		{Name: "unpackaged/classes/Piyo.cls", Body: []byte("public class Piyo {}")},
+	}).Install())
+
+	f, err := ioutil.TempFile("", "package.toml")
+	assert.Nil(t, err)
+	defer os.Remove(f.Name())
+	f.WriteString("version = 38.0\n[[types]]\nname = \"ApexClass\"\nmembers = [\"*\"]\n")
+	f.Close()
+
+	uri := func(server *httptest.Server) string {
+		return "sf://hoge@example.com:fuga@" + strings.TrimPrefix(server.URL, "https://") + "?path=" + f.Name()
+	}
+	comparison, err := compareOrgs(NewSpmLogger(ioutil.Discard, ioutil.Discard), uri(source), uri(target))
+	assert.Nil(t, err)
+	assert.Equal(t, 3, len(comparison.Components))
+	assert.Equal(t, &ComponentDiff{Type: "ApexClass", Member: "Fuga", Status: DIFF_MISSING}, comparison.Components[0])
+	assert.Equal(t, DIFF_CHANGED, comparison.Components[1].Status)
+	assert.Equal(t, "--- target/classes/Hoge.cls\n+++ source/classes/Hoge.cls\n@@ -1,1 +1,1 @@\n-public class Hoge {}\n+public class Hoge { Integer i; }\n", comparison.Components[1].Diff)
+	assert.Equal(t, &ComponentDiff{Type: "ApexClass", Member: "Piyo", Status: DIFF_EXTRA}, comparison.Components[2])
+	assert.Equal(t, map[string]int{DIFF_IDENTICAL: 0, DIFF_CHANGED: 1, DIFF_MISSING: 1, DIFF_EXTRA: 1}, comparison.Summary)
+	assert.NotContains(t, comparison.Source, "fuga")
+
+	buf := new(bytes.Buffer)
+	assert.Nil(t, comparison.WriteHTML(buf))
+	assert.Contains(t, buf.String(), `<tr class="changed"><td>ApexClass</td><td>Hoge</td><td>changed</td></tr>`)
+	assert.Contains(t, buf.String(), "public class Hoge { Integer i; }\n</pre>")
+
+	_, err = compareOrgs(NewSpmLogger(ioutil.Discard, ioutil.Discard), "tzmfreedom/hoge", uri(target))
+	assert.EqualError(t, err, "tzmfreedom/hoge is not an org. Use sf:// URI")
+}
+
+func TestNormalizeOrgSource(t *testing.T) {
+	a := []byte("<?xml version=\"1.0\" encoding=\"UTF-8\"?>\r\n<Profile>\r\n<fieldPermissions><field>A.b__c</field></fieldPermissions>\r\n<fieldPermissions><field>A.a__c</field></fieldPermissions>\r\n<apiVersion>41.0</apiVersion>\r\n</Profile>\r\n")
+	b := []byte("<?xml version=\"1.0\" encoding=\"UTF-8\"?>\n<Profile>\n    <fieldPermissions>\n        <field>A.a__c</field>\n    </fieldPermissions>\n    <fieldPermissions>\n        <field>A.b__c</field>\n    </fieldPermissions>\n</Profile>\n")
+	assert.Equal(t, string(b), string(normalizeOrgSource("profiles/Admin.profile", a)))
+	assert.Equal(t, "public class Hoge {}\n", string(normalizeOrgSource("classes/Hoge.cls", []byte("public class Hoge {}\r\n"))))
+}
+
+func TestCompareJsonReport(t *testing.T) {
+	cli, _, _ := before()
+	outStream := new(bytes.Buffer)
+	cli.outStream = outStream
+	cli.errStream = new(bytes.Buffer)
+	cli.Run([]string{"spm", "--json", "compare", "--format", "json", "sf://@staging", "sf://@prod"})
+
+	report := &CommandReport{}
+	assert.Nil(t, json.Unmarshal(outStream.Bytes(), report))
+	assert.Equal(t, "compare", report.Command)
+	assert.Equal(t, "--json and --format json cannot be used together without --output", report.Error)
+}
@@ -0,0 +1,266 @@
+package main
+
+import (
+	"encoding/xml"
+	"path"
+	"sort"
+	"strings"
+)
+
+const METADATA_NAMESPACE = "http://soap.sforce.com/2006/04/metadata"
+
+type metadataType struct {
+	Name      string
+	Directory string
+	Suffix    string
+	MetaFile  bool
+	InFolder  bool
+	Bundle    bool
+}
+
+// metadataTypes maps the directories of a metadata package to its types.
+var metadataTypes = []*metadataType{
+	{Name: "ApexClass", Directory: "classes", Suffix: "cls", MetaFile: true},
+	{Name: "ApexComponent", Directory: "components", Suffix: "component", MetaFile: true},
+	{Name: "ApexPage", Directory: "pages", Suffix: "page", MetaFile: true},
+	{Name: "ApexTrigger", Directory: "triggers", Suffix: "trigger", MetaFile: true},
+	{Name: "StaticResource", Directory: "staticresources", Suffix: "resource", MetaFile: true},
+	{Name: "AuraDefinitionBundle", Directory: "aura", Bundle: true},
+	{Name: "LightningComponentBundle", Directory: "lwc", Bundle: true},
+	{Name: "CustomObject", Directory: "objects", Suffix: "object"},
+	{Name: "CustomObjectTranslation", Directory: "objectTranslations", Suffix: "objectTranslation"},
+	{Name: "CustomApplication", Directory: "applications", Suffix: "app"},
+	{Name: "CustomLabels", Directory: "labels", Suffix: "labels"},
+	{Name: "CustomMetadata", Directory: "customMetadata", Suffix: "md"},
+	{Name: "CustomPermission", Directory: "customPermissions", Suffix: "customPermission"},
+	{Name: "CustomSite", Directory: "sites", Suffix: "site"},
+	{Name: "CustomTab", Directory: "tabs", Suffix: "tab"},
+	{Name: "FlexiPage", Directory: "flexipages", Suffix: "flexipage"},
+	{Name: "Flow", Directory: "flows", Suffix: "flow"},
+	{Name: "FlowDefinition", Directory: "flowDefinitions", Suffix: "flowDefinition"},
+	{Name: "GlobalValueSet", Directory: "globalValueSets", Suffix: "globalValueSet"},
+	{Name: "Group", Directory: "groups", Suffix: "group"},
+	{Name: "HomePageComponent", Directory: "homePageComponents", Suffix: "homePageComponent"},
+	{Name: "HomePageLayout", Directory: "homePageLayouts", Suffix: "homePageLayout"},
+	{Name: "Layout", Directory: "layouts", Suffix: "layout"},
+	{Name: "NamedCredential", Directory: "namedCredentials", Suffix: "namedCredential"},
+	{Name: "PermissionSet", Directory: "permissionsets", Suffix: "permissionset"},
+	{Name: "Profile", Directory: "profiles", Suffix: "profile"},
+	{Name: "Queue", Directory: "queues", Suffix: "queue"},
+	{Name: "QuickAction", Directory: "quickActions", Suffix: "quickAction"},
+	{Name: "RemoteSiteSetting", Directory: "remoteSiteSettings", Suffix: "remoteSite"},
+	{Name: "Role", Directory: "roles", Suffix: "role"},
+	{Name: "Settings", Directory: "settings", Suffix: "settings"},
+	{Name: "StandardValueSet", Directory: "standardValueSets", Suffix: "standardValueSet"},
+	{Name: "Translations", Directory: "translations", Suffix: "translation"},
+	{Name: "Workflow", Directory: "workflows", Suffix: "workflow"},
+	{Name: "AssignmentRules", Directory: "assignmentRules", Suffix: "assignmentRules"},
+	{Name: "AutoResponseRules", Directory: "autoResponseRules", Suffix: "autoResponseRules"},
+	{Name: "EscalationRules", Directory: "escalationRules", Suffix: "escalationRules"},
+	{Name: "ApprovalProcess", Directory: "approvalProcesses", Suffix: "approvalProcess"},
+	{Name: "AuthProvider", Directory: "authproviders", Suffix: "authprovider"},
+	{Name: "ConnectedApp", Directory: "connectedApps", Suffix: "connectedApp"},
+	{Name: "ContentAsset", Directory: "contentassets", Suffix: "asset", MetaFile: true},
+	{Name: "CustomNotificationType", Directory: "notificationtypes", Suffix: "notiftype"},
+	{Name: "CustomPageWebLink", Directory: "weblinks", Suffix: "weblink"},
+	{Name: "DuplicateRule", Directory: "duplicateRules", Suffix: "duplicateRule"},
+	{Name: "ExternalDataSource", Directory: "dataSources", Suffix: "dataSource"},
+	{Name: "Letterhead", Directory: "letterhead", Suffix: "letter"},
+	{Name: "MatchingRules", Directory: "matchingRules", Suffix: "matchingRule"},
+	{Name: "PathAssistant", Directory: "pathAssistants", Suffix: "pathAssistant"},
+	{Name: "PlatformCachePartition", Directory: "cachePartitions", Suffix: "cachePartition"},
+	{Name: "ReportType", Directory: "reportTypes", Suffix: "reportType"},
+	{Name: "SharingRules", Directory: "sharingRules", Suffix: "sharingRules"},
+	{Name: "Document", Directory: "documents", InFolder: true, MetaFile: true},
+	{Name: "EmailTemplate", Directory: "email", Suffix: "email", InFolder: true, MetaFile: true},
+	{Name: "Report", Directory: "reports", Suffix: "report", InFolder: true},
+	{Name: "Dashboard", Directory: "dashboards", Suffix: "dashboard", InFolder: true},
+}
+
+type component struct {
+	Type   string
+	Member string
+}
+
+func findMetadataTypeByDirectory(dir string) *metadataType {
+	for _, t := range metadataTypes {
+		if t.Directory == dir {
+			return t
+		}
+	}
+	return nil
+}
+
+func findMetadataTypeByName(name string) *metadataType {
+	for _, t := range metadataTypes {
+		if t.Name == name {
+			return t
+		}
+	}
+	return nil
+}
+
+// componentOf returns the component a file belongs to.
+// The file name is relative to the package root, i.g. classes/Hoge.cls-meta.xml
+func componentOf(name string) (*component, bool) {
+	name = path.Clean(strings.Replace(name, "\\", "/", -1))
+	parts := strings.Split(name, "/")
+	if len(parts) < 2 {
+		return nil, false
+	}
+	t := findMetadataTypeByDirectory(parts[0])
+	if t == nil {
+		return nil, false
+	}
+	if t.Bundle {
+		return &component{Type: t.Name, Member: parts[1]}, true
+	}
+	rest := strings.TrimSuffix(strings.Join(parts[1:], "/"), "-meta.xml")
+	if t.InFolder {
+		// folders are deployed as members of the type itself
+		if len(parts) == 2 {
+			return &component{Type: t.Name, Member: rest}, true
+		}
+	}
+	// documents keep their file extension in the member name
+	if t.Suffix != "" {
+		rest = strings.TrimSuffix(rest, "."+t.Suffix)
+	}
+	return &component{Type: t.Name, Member: rest}, true
+}
+
+// componentResolver finds the components of the files of a package. Files in directories missing from
+// metadataTypes belong to the type of package.xml named after the directory (i.g. QuickText of quickTexts)
+// if it lists the file name without the suffix as the member, or the wildcard.
+type componentResolver struct {
+	// members are the members of the types of package.xml missing from metadataTypes
+	members map[string][]string
+}
+
+func newComponentResolver(files []*File) *componentResolver {
+	r := &componentResolver{members: map[string][]string{}}
+	for _, f := range files {
+		if _, name := splitPackageRoot(f.Name); name != "package.xml" {
+			continue
+		}
+		p, err := parsePackageXML(f.Body)
+		if err != nil {
+			continue
+		}
+		for _, t := range p.Types {
+			if findMetadataTypeByName(t.Name) == nil {
+				r.members[t.Name] = append(r.members[t.Name], t.Members...)
+			}
+		}
+	}
+	return r
+}
+
+// componentOf returns the component a file belongs to by metadataTypes, or by package.xml for unknown directories.
+func (r *componentResolver) componentOf(name string) (*component, bool) {
+	if c, ok := componentOf(name); ok {
+		return c, true
+	}
+	name = path.Clean(strings.Replace(name, "\\", "/", -1))
+	parts := strings.Split(name, "/")
+	if len(parts) < 2 {
+		return nil, false
+	}
+	rest := strings.TrimSuffix(strings.Join(parts[1:], "/"), "-meta.xml")
+	types := []string{}
+	for t := range r.members {
+		if strings.HasPrefix(strings.ToLower(parts[0]), strings.ToLower(t)) {
+			types = append(types, t)
+		}
+	}
+	// the longest type name matches, i.g. Territory2Model of territory2Models rather than Territory2
+	sort.Slice(types, func(i, j int) bool { return len(types[i]) > len(types[j]) })
+	for _, t := range types {
+		members := r.members[t]
+		for _, member := range []string{strings.TrimSuffix(rest, path.Ext(rest)), rest, parts[1]} {
+			if containsString(members, member) || containsString(members, "*") {
+				return &component{Type: t, Member: member}, true
+			}
+		}
+	}
+	return nil, false
+}
+
+// isMetadataFile returns true if the file is in a directory of the package root, where metadata types are.
+// Hidden directories (i.g. .github) are not metadata.
+func isMetadataFile(name string) bool {
+	name = strings.Replace(name, "\\", "/", -1)
+	return strings.Contains(name, "/") && !strings.HasPrefix(name, ".")
+}
+
+// splitPackageRoot splits a file name in a metadata zip into its root directory
+// (i.g. unpackaged) and the name relative to it.
+func splitPackageRoot(name string) (string, string) {
+	name = strings.Replace(name, "\\", "/", -1)
+	i := strings.Index(name, "/")
+	if i < 0 {
+		return "", name
+	}
+	return name[:i], name[i+1:]
+}
+
+// packageXML is a manifest of components, i.g. package.xml or destructiveChanges.xml
+type packageXML struct {
+	XMLName xml.Name              `xml:"Package"`
+	Xmlns   string                `xml:"xmlns,attr,omitempty"`
+	Types   []*PackageTypeMembers `xml:"types"`
+	Version string                `xml:"version,omitempty"`
+}
+
+func parsePackageXML(b []byte) (*packageXML, error) {
+	p := &packageXML{}
+	if err := xml.Unmarshal(b, p); err != nil {
+		return nil, err
+	}
+	return p, nil
+}
+
+// newPackageXML creates a manifest of the components sorted by type and member.
+func newPackageXML(components []*component, version string) *packageXML {
+	members := map[string][]string{}
+	for _, c := range components {
+		if !containsString(members[c.Type], c.Member) {
+			members[c.Type] = append(members[c.Type], c.Member)
+		}
+	}
+	names := make([]string, 0, len(members))
+	for name := range members {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	p := &packageXML{Xmlns: METADATA_NAMESPACE, Version: version, Types: []*PackageTypeMembers{}}
+	for _, name := range names {
+		sort.Strings(members[name])
+		p.Types = append(p.Types, &PackageTypeMembers{Name: name, Members: members[name]})
+	}
+	return p
+}
+
+func (p *packageXML) Components() []*component {
+	components := []*component{}
+	for _, t := range p.Types {
+		for _, m := range t.Members {
+			components = append(components, &component{Type: t.Name, Member: m})
+		}
+	}
+	return components
+}
+
+func (p *packageXML) Bytes() []byte {
+	b, _ := xml.MarshalIndent(p, "", "    ")
+	return append([]byte(xml.Header), append(b, '\n')...)
+}
+
+func containsString(list []string, s string) bool {
+	for _, v := range list {
+		if v == s {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,76 @@
+package main
+
+import "fmt"
+
+// credentials are the ways to authenticate to salesforce.
+// Access token, refresh token and JWT bearer flow take precedence over username and password.
+type credentials struct {
+	Username      string
+	Password      string
+	TokenEndpoint string
+	ClientId      string
+	ClientSecret  string
+	RefreshToken  string
+	JwtKeyFile    string
+	AccessToken   string
+	InstanceUrl   string
+}
+
+func (c *credentials) validate(name string) error {
+	switch {
+	case c.AccessToken != "":
+		if c.InstanceUrl == "" {
+			return fmt.Errorf("[%s] Instance URL is required", name)
+		}
+	case c.RefreshToken != "":
+		if c.ClientId == "" {
+			return fmt.Errorf("[%s] Client ID is required", name)
+		}
+	case c.JwtKeyFile != "":
+		if c.ClientId == "" {
+			return fmt.Errorf("[%s] Client ID is required", name)
+		}
+		if c.Username == "" {
+			return fmt.Errorf("[%s] Username is required", name)
+		}
+	default:
+		if c.Username == "" {
+			return fmt.Errorf("[%s] Username is required", name)
+		}
+		if c.Password == "" {
+			return fmt.Errorf("[%s] Password is required", name)
+		}
+	}
+	return nil
+}
+
+func (c *credentials) login(client *ForceClient) error {
+	for _, secret := range []string{c.Password, c.ClientSecret, c.RefreshToken, c.AccessToken} {
+		redactor.Add(secret)
+	}
+	if c.AccessToken != "" {
+		// the existing session is used as is, since it can not be renewed
+		if err := c.authenticate(client); err != nil {
+			return &AuthenticationError{err}
+		}
+		redactor.Add(client.loginResult.SessionId)
+		return nil
+	}
+	return sessions.Get(sessionKey(client.endpoint, client.apiVersion, c)).Login(client, c.authenticate)
+}
+
+func (c *credentials) authenticate(client *ForceClient) error {
+	switch {
+	case c.AccessToken != "":
+		return client.LoginWithAccessToken(c.AccessToken, c.InstanceUrl)
+	case c.RefreshToken != "":
+		return client.LoginWithRefreshToken(c.TokenEndpoint, c.ClientId, c.ClientSecret, c.RefreshToken)
+	case c.JwtKeyFile != "":
+		key, err := readPrivateKey(c.JwtKeyFile)
+		if err != nil {
+			return err
+		}
+		return client.LoginWithJWT(c.TokenEndpoint, c.ClientId, c.Username, key)
+	}
+	return client.Login(c.Username, c.Password)
+}
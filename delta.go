@@ -0,0 +1,50 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"strings"
+)
+
+// deltaRefs returns the base and head refs of --since or --diff.
+// head is empty to deploy the downloaded ref, and base is empty without delta deployment.
+func (c *config) deltaRefs() (string, string, error) {
+	if c.Since != "" && c.Diff != "" {
+		return "", "", errors.New("--since and --diff cannot be used together")
+	}
+	if c.Diff == "" {
+		return c.Since, "", nil
+	}
+	refs := strings.SplitN(c.Diff, "..", 2)
+	if len(refs) != 2 || refs[0] == "" || refs[1] == "" {
+		return "", "", fmt.Errorf("Invalid diff: %s. Use base..head", c.Diff)
+	}
+	return refs[0], refs[1], nil
+}
+
+// delta returns the files of the components changed between the refs of --since or --diff,
+// with destructiveChangesPost.xml of the deleted components. The files are returned as is without delta deployment.
+func (i *SalesforceInstaller) delta(files []*File) ([]*File, error) {
+	base, head, err := i.config.deltaRefs()
+	if err != nil || base == "" {
+		return files, err
+	}
+	gd, ok := i.downloader.(*GitDownloader)
+	if !ok {
+		return nil, fmt.Errorf("%s: Delta deployments support git repositories only", i.uri)
+	}
+	if head != "" {
+		files, i.result.Commit, err = gd.DownloadRef(head)
+		if err != nil {
+			return nil, &DownloadError{err}
+		}
+	}
+	baseFiles, baseCommit, err := gd.DownloadRef(base)
+	if err != nil {
+		return nil, &DownloadError{err}
+	}
+	plan := planUpgrade(baseFiles, files)
+	i.logger.Infof("%s: Deploy changes from %s to %s", i.uri, baseCommit, i.result.Commit)
+	i.logPlan(plan)
+	return plan.Files(files, nil)
+}
@@ -0,0 +1,93 @@
+package main
+
+import (
+	"io/ioutil"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestDeltaRefs(t *testing.T) {
+	base, head, err := (&config{Since: "v1.0"}).deltaRefs()
+	assert.Nil(t, err)
+	assert.Equal(t, "v1.0", base)
+	assert.Equal(t, "", head)
+
+	base, head, err = (&config{Diff: "v1.0..develop"}).deltaRefs()
+	assert.Nil(t, err)
+	assert.Equal(t, "v1.0", base)
+	assert.Equal(t, "develop", head)
+
+	_, _, err = (&config{Diff: "v1.0"}).deltaRefs()
+	assert.EqualError(t, err, "Invalid diff: v1.0. Use base..head")
+	_, _, err = (&config{Since: "v1.0", Diff: "v1.0..develop"}).deltaRefs()
+	assert.EqualError(t, err, "--since and --diff cannot be used together")
+
+	base, _, err = (&config{}).deltaRefs()
+	assert.Nil(t, err)
+	assert.Equal(t, "", base)
+}
+
+func TestDeltaBundle(t *testing.T) {
+	oldFiles := []*File{
+		{Name: "unpackaged/package.xml", Body: newPackageXML([]*component{{Type: "LightningComponentBundle", Member: "*"}}, "45.0").Bytes()},
+		{Name: "unpackaged/lwc/hoge/hoge.js", Body: []byte("export default class Hoge {}")},
+		{Name: "unpackaged/lwc/hoge/hoge.html", Body: []byte("<template></template>")},
+		{Name: "unpackaged/lwc/fuga/fuga.js", Body: []byte("export default class Fuga {}")},
+	}
+	newFiles := []*File{
+		{Name: "unpackaged/package.xml", Body: newPackageXML([]*component{{Type: "LightningComponentBundle", Member: "*"}}, "45.0").Bytes()},
+		{Name: "unpackaged/lwc/hoge/hoge.js", Body: []byte("export default class Hoge {}")},
+		{Name: "unpackaged/lwc/hoge/hoge.html", Body: []byte("<template><p></p></template>")},
+		{Name: "unpackaged/lwc/fuga/fuga.js", Body: []byte("export default class Fuga {}")},
+	}
+	plan := planUpgrade(oldFiles, newFiles)
+	files, err := plan.Files(newFiles, nil)
+	assert.Nil(t, err)
+	names := []string{}
+	for _, f := range files {
+		names = append(names, f.Name)
+	}
+	assert.Equal(t, []string{"unpackaged/lwc/hoge/hoge.js", "unpackaged/lwc/hoge/hoge.html", "unpackaged/package.xml"}, names)
+}
+
+func TestDeltaRequiresGitRepository(t *testing.T) {
+	installer := &SalesforceInstaller{
+		uri:        "sf://hoge:fuga@login.salesforce.com",
+		downloader: &stubDownloader{},
+		config:     &config{Since: "v1.0"},
+		logger:     NewSpmLogger(ioutil.Discard, ioutil.Discard),
+	}
+	_, err := installer.delta(mockPackageFiles)
+	assert.EqualError(t, err, "sf://hoge:fuga@login.salesforce.com: Delta deployments support git repositories only")
+
+	installer.config = &config{}
+	files, err := installer.delta(mockPackageFiles)
+	assert.Nil(t, err)
+	assert.Equal(t, mockPackageFiles, files)
+}
+
+func TestDeltaUnknownTypes(t *testing.T) {
+	oldFiles := []*File{
+		{Name: "unpackaged/package.xml", Body: newPackageXML([]*component{{Type: "QuickText", Member: "*"}}, "45.0").Bytes()},
+		{Name: "unpackaged/quickTexts/Hoge.quickText", Body: []byte("<QuickText><message>hoge</message></QuickText>")},
+		{Name: "unpackaged/quickTexts/Fuga.quickText", Body: []byte("<QuickText/>")},
+	}
+	newFiles := []*File{
+		{Name: "unpackaged/package.xml", Body: newPackageXML([]*component{{Type: "QuickText", Member: "*"}}, "45.0").Bytes()},
+		{Name: "unpackaged/quickTexts/Hoge.quickText", Body: []byte("<QuickText><message>fuga</message></QuickText>")},
+		{Name: "unpackaged/quickTexts/Fuga.quickText", Body: []byte("<QuickText/>")},
+		{Name: "unpackaged/unknowns/Hoge.unknown", Body: []byte("<Unknown/>")},
+	}
+	plan := planUpgrade(oldFiles, newFiles)
+	assert.Equal(t, []*component{{Type: "QuickText", Member: "Hoge"}}, plan.Changed)
+	assert.Equal(t, []string{"unknowns/Hoge.unknown"}, plan.Skipped)
+
+	files, err := plan.Files(newFiles, nil)
+	assert.Nil(t, err)
+	names := []string{}
+	for _, f := range files {
+		names = append(names, f.Name)
+	}
+	assert.Equal(t, []string{"unpackaged/quickTexts/Hoge.quickText", "unpackaged/package.xml"}, names)
+}
@@ -0,0 +1,363 @@
+package main
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"sort"
+	"strconv"
+	"strings"
+)
+
+const (
+	DIFF_IDENTICAL = "identical"
+	DIFF_CHANGED   = "changed"
+	DIFF_MISSING   = "missing"
+	DIFF_EXTRA     = "extra"
+)
+
+// ComponentDiff is the difference of a component between the package and the org.
+// Missing components are in the package only, extra components are in the org only.
+type ComponentDiff struct {
+	Type   string `json:"type"`
+	Member string `json:"member"`
+	Status string `json:"status"`
+	Diff   string `json:"diff,omitempty"`
+}
+
+func (i *SalesforceInstaller) Diff() error {
+	i.result = NewPackageResult(i.uri)
+	err := i.diff()
+	i.finish(err)
+	return err
+}
+
+// diff retrieves the components of package.xml of the package from the org and compares them with the package.
+func (i *SalesforceInstaller) diff() error {
+	files, err := i.download()
+	if err != nil {
+		return err
+	}
+	if isZipped(files) {
+		files, err = unzipFiles(files[0].Body)
+		if err != nil {
+			return err
+		}
+	}
+	var manifest *packageXML
+	for _, f := range files {
+		if _, name := splitPackageRoot(f.Name); name == "package.xml" {
+			manifest, err = parsePackageXML(f.Body)
+			if err != nil {
+				return err
+			}
+		}
+	}
+	if manifest == nil {
+		return errors.New("Package.xml Not Found")
+	}
+	orgFiles, err := i.retrieveComponents(manifest.Components())
+	if err != nil {
+		return err
+	}
+
+	diffs, skipped := compareComponents(files, orgFiles)
+	for _, name := range skipped {
+		i.logger.Warningf("%s: %s is not compared. The metadata type of the file is unknown. List it in package.xml", i.uri, name)
+	}
+	counts := map[string]int{}
+	for _, d := range diffs {
+		counts[d.Status]++
+		i.logger.Infof("  %-9s %s %s", d.Status, d.Type, d.Member)
+		if d.Diff != "" {
+			i.logger.Info(d.Diff)
+		}
+	}
+	i.result.Diffs = diffs
+	i.logger.Infof("%s: %d identical, %d changed, %d missing in the org, %d extra in the org",
+		i.uri, counts[DIFF_IDENTICAL], counts[DIFF_CHANGED], counts[DIFF_MISSING], counts[DIFF_EXTRA])
+	return nil
+}
+
+func (i *SalesforceInstaller) retrieveComponents(components []*component) ([]*File, error) {
+	version, err := strconv.ParseFloat(i.config.ApiVersion, 64)
+	if err != nil {
+		return nil, err
+	}
+	p := &MetaPackageFile{Version: version}
+	for _, t := range newPackageXML(components, "").Types {
+		p.Types = append(p.Types, &Type{Name: t.Name, Members: t.Members})
+	}
+	request, err := createRetrieveRequest(p)
+	if err != nil {
+		return nil, err
+	}
+	return i.client.RetrieveFiles(request)
+}
+
+// compareComponents compares the components of the package with the ones retrieved from the org.
+// The files of unknown metadata types are returned as skipped.
+func compareComponents(files []*File, orgFiles []*File) ([]*ComponentDiff, []string) {
+	c := &componentComparer{source: "package", target: "org", normalize: normalizeMetadata}
+	return c.compare(files, orgFiles)
+}
+
+// componentComparer compares the components of a source (i.g. a package) with a target (i.g. an org).
+// Components are missing if in the source only, and extra if in the target only.
+// Diffs are from the target to the source, i.e. the changes deploying the source would make.
+type componentComparer struct {
+	source    string
+	target    string
+	normalize func(name string, body []byte) []byte
+}
+
+// compare compares the files of the components normalized for stable diffs. The registry records of spm are ignored.
+// The files of unknown metadata types in the source or the target are returned as skipped.
+func (c *componentComparer) compare(files []*File, targetFiles []*File) ([]*ComponentDiff, []string) {
+	sources, skipped := groupByComponent(files)
+	targets, targetSkipped := groupByComponent(targetFiles)
+	for _, name := range targetSkipped {
+		if !containsString(skipped, name) {
+			skipped = append(skipped, name)
+		}
+	}
+	sort.Strings(skipped)
+	keys := []string{}
+	for key, s := range sources {
+		if !isRegistryRecord(s.component) {
+			keys = append(keys, key)
+		}
+	}
+	for key, t := range targets {
+		if _, ok := sources[key]; !ok && !isRegistryRecord(t.component) {
+			keys = append(keys, key)
+		}
+	}
+	sort.Strings(keys)
+
+	diffs := []*ComponentDiff{}
+	for _, key := range keys {
+		s, inSource := sources[key]
+		t, inTarget := targets[key]
+		switch {
+		case !inTarget:
+			diffs = append(diffs, &ComponentDiff{Type: s.component.Type, Member: s.component.Member, Status: DIFF_MISSING})
+		case !inSource:
+			diffs = append(diffs, &ComponentDiff{Type: t.component.Type, Member: t.component.Member, Status: DIFF_EXTRA})
+		default:
+			d := &ComponentDiff{Type: s.component.Type, Member: s.component.Member, Status: DIFF_IDENTICAL}
+			d.Diff = c.diff(t.files, s.files)
+			if d.Diff != "" {
+				d.Status = DIFF_CHANGED
+			}
+			diffs = append(diffs, d)
+		}
+	}
+	return diffs, skipped
+}
+
+func isRegistryRecord(c *component) bool {
+	return c.Type == "StaticResource" && strings.HasPrefix(c.Member, REGISTRY_PREFIX)
+}
+
+// diff returns the unified diff of the files of a component from the target to the source.
+func (c *componentComparer) diff(targetFiles map[string][]byte, files map[string][]byte) string {
+	names := []string{}
+	for name := range files {
+		names = append(names, name)
+	}
+	for name := range targetFiles {
+		if _, ok := files[name]; !ok {
+			names = append(names, name)
+		}
+	}
+	sort.Strings(names)
+	buf := new(bytes.Buffer)
+	for _, name := range names {
+		from, to := c.target+"/"+name, c.source+"/"+name
+		t, ok := targetFiles[name]
+		if !ok {
+			from = "/dev/null"
+		}
+		s, ok := files[name]
+		if !ok {
+			to = "/dev/null"
+		}
+		buf.WriteString(unifiedDiff(from, to, c.normalize(name, t), c.normalize(name, s)))
+	}
+	return buf.String()
+}
+
+// normalizeOrgSource normalizes the file like normalizeMetadata, and removes <apiVersion>,
+// which differs between orgs by the api version the components were last saved with.
+func normalizeOrgSource(name string, body []byte) []byte {
+	body = normalizeMetadata(name, body)
+	if !bytes.HasPrefix(body, []byte("<?xml")) {
+		return body
+	}
+	doc, err := parseXML(body)
+	if err != nil {
+		return body
+	}
+	doc.Root.RemoveChildren(func(n *xmlNode) bool { return n.Name == "apiVersion" })
+	return doc.Bytes()
+}
+
+const diffContext = 3
+
+// maxDiffCells limits the size of the table to find the longest common lines.
+// Larger changes are shown as the replacement of all the changed lines.
+const maxDiffCells = 4000000
+
+type diffLine struct {
+	op   byte
+	text string
+}
+
+// unifiedDiff returns the difference of the texts in unified format, or "" if they are the same.
+func unifiedDiff(from string, to string, a []byte, b []byte) string {
+	lines := diffLines(splitLines(a), splitLines(b))
+	changed := false
+	for _, l := range lines {
+		changed = changed || l.op != ' '
+	}
+	if !changed {
+		return ""
+	}
+	buf := new(bytes.Buffer)
+	fmt.Fprintf(buf, "--- %s\n+++ %s\n", from, to)
+	for i := 0; i < len(lines); {
+		if lines[i].op == ' ' {
+			i++
+			continue
+		}
+		start := i - diffContext
+		if start < 0 {
+			start = 0
+		}
+		end := i
+		for j := i; j < len(lines); j++ {
+			if lines[j].op != ' ' {
+				end = j
+			} else if j-end > 2*diffContext {
+				break
+			}
+		}
+		stop := end + diffContext + 1
+		if stop > len(lines) {
+			stop = len(lines)
+		}
+		aStart, bStart := 1, 1
+		for _, l := range lines[:start] {
+			if l.op != '+' {
+				aStart++
+			}
+			if l.op != '-' {
+				bStart++
+			}
+		}
+		aCount, bCount := 0, 0
+		for _, l := range lines[start:stop] {
+			if l.op != '+' {
+				aCount++
+			}
+			if l.op != '-' {
+				bCount++
+			}
+		}
+		if aCount == 0 {
+			aStart--
+		}
+		if bCount == 0 {
+			bStart--
+		}
+		fmt.Fprintf(buf, "@@ -%d,%d +%d,%d @@\n", aStart, aCount, bStart, bCount)
+		for _, l := range lines[start:stop] {
+			buf.WriteByte(l.op)
+			buf.WriteString(l.text + "\n")
+		}
+		i = stop
+	}
+	return buf.String()
+}
+
+func splitLines(b []byte) []string {
+	s := strings.TrimSuffix(string(b), "\n")
+	if s == "" {
+		return []string{}
+	}
+	return strings.Split(s, "\n")
+}
+
+// diffLines returns the edit script from a to b. Common prefix and suffix lines are kept as they are,
+// and the lines between them are compared by the longest common subsequence.
+func diffLines(a []string, b []string) []diffLine {
+	prefix := 0
+	for prefix < len(a) && prefix < len(b) && a[prefix] == b[prefix] {
+		prefix++
+	}
+	suffix := 0
+	for suffix < len(a)-prefix && suffix < len(b)-prefix && a[len(a)-1-suffix] == b[len(b)-1-suffix] {
+		suffix++
+	}
+	lines := []diffLine{}
+	for _, l := range a[:prefix] {
+		lines = append(lines, diffLine{' ', l})
+	}
+	lines = append(lines, lcsDiff(a[prefix:len(a)-suffix], b[prefix:len(b)-suffix])...)
+	for _, l := range a[len(a)-suffix:] {
+		lines = append(lines, diffLine{' ', l})
+	}
+	return lines
+}
+
+func lcsDiff(a []string, b []string) []diffLine {
+	lines := []diffLine{}
+	if len(a)*len(b) > maxDiffCells {
+		for _, l := range a {
+			lines = append(lines, diffLine{'-', l})
+		}
+		for _, l := range b {
+			lines = append(lines, diffLine{'+', l})
+		}
+		return lines
+	}
+	// lcs[i][j] is the length of the longest common subsequence of a[i:] and b[j:]
+	lcs := make([][]int, len(a)+1)
+	for i := range lcs {
+		lcs[i] = make([]int, len(b)+1)
+	}
+	for i := len(a) - 1; i >= 0; i-- {
+		for j := len(b) - 1; j >= 0; j-- {
+			if a[i] == b[j] {
+				lcs[i][j] = lcs[i+1][j+1] + 1
+			} else if lcs[i+1][j] >= lcs[i][j+1] {
+				lcs[i][j] = lcs[i+1][j]
+			} else {
+				lcs[i][j] = lcs[i][j+1]
+			}
+		}
+	}
+	i, j := 0, 0
+	for i < len(a) && j < len(b) {
+		switch {
+		case a[i] == b[j]:
+			lines = append(lines, diffLine{' ', a[i]})
+			i++
+			j++
+		case lcs[i+1][j] >= lcs[i][j+1]:
+			lines = append(lines, diffLine{'-', a[i]})
+			i++
+		default:
+			lines = append(lines, diffLine{'+', b[j]})
+			j++
+		}
+	}
+	for ; i < len(a); i++ {
+		lines = append(lines, diffLine{'-', a[i]})
+	}
+	for ; j < len(b); j++ {
+		lines = append(lines, diffLine{'+', b[j]})
+	}
+	return lines
+}
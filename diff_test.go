@@ -0,0 +1,90 @@
+package main
+
+import (
+	"io/ioutil"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestUnifiedDiff(t *testing.T) {
+	a := []byte("a\nb\nc\nd\ne\nf\ng\nh\ni\nj\n")
+	b := []byte("a\nb\nc\nd\nE\nf\ng\nh\ni\nj\nk\n")
+	assert.Equal(t, `--- org/a.txt
++++ package/a.txt
+@@ -2,9 +2,10 @@
+ b
+ c
+ d
+-e
++E
+ f
+ g
+ h
+ i
+ j
++k
+`, unifiedDiff("org/a.txt", "package/a.txt", a, b))
+	assert.Equal(t, "", unifiedDiff("org/a.txt", "package/a.txt", a, a))
+	assert.Equal(t, "--- /dev/null\n+++ package/a.txt\n@@ -0,0 +1,1 @@\n+a\n", unifiedDiff("/dev/null", "package/a.txt", nil, []byte("a\n")))
+}
+
+func TestCompareComponents(t *testing.T) {
+	files := []*File{
+		{Name: "unpackaged/package.xml", Body: newPackageXML([]*component{{Type: "ApexClass", Member: "*"}}, "38.0").Bytes()},
+		{Name: "unpackaged/classes/Hoge.cls", Body: []byte("public class Hoge {}")},
+		{Name: "unpackaged/classes/Hoge.cls-meta.xml", Body: []byte("<?xml version=\"1.0\" encoding=\"UTF-8\"?>\r\n<ApexClass>\r\n  <status>Active</status>\r\n</ApexClass>\r\n")},
+		{Name: "unpackaged/classes/Fuga.cls", Body: []byte("public class Fuga {}")},
+		{Name: "unpackaged/classes/Piyo.cls", Body: []byte("public class Piyo {}")},
+	}
+	orgFiles := []*File{
+		{Name: "unpackaged/package.xml", Body: newPackageXML([]*component{{Type: "ApexClass", Member: "Hoge"}}, "38.0").Bytes()},
+		{Name: "unpackaged/classes/Hoge.cls", Body: []byte("public class Hoge {}")},
+		{Name: "unpackaged/classes/Hoge.cls-meta.xml", Body: []byte("<?xml version=\"1.0\" encoding=\"UTF-8\"?>\n<ApexClass>\n    <status>Active</status>\n</ApexClass>\n")},
+		{Name: "unpackaged/classes/Fuga.cls", Body: []byte("public class Fuga { }")},
+		{Name: "unpackaged/classes/Foo.cls", Body: []byte("public class Foo {}")},
+		{Name: "unpackaged/staticresources/spm_hoge_12345678.resource", Body: []byte("{}")},
+	}
+	diffs, skipped := compareComponents(files, orgFiles)
+	assert.Equal(t, 0, len(skipped))
+	assert.Equal(t, 4, len(diffs))
+	assert.Equal(t, &ComponentDiff{Type: "ApexClass", Member: "Foo", Status: DIFF_EXTRA}, diffs[0])
+	assert.Equal(t, "Fuga", diffs[1].Member)
+	assert.Equal(t, DIFF_CHANGED, diffs[1].Status)
+	assert.Equal(t, "--- org/classes/Fuga.cls\n+++ package/classes/Fuga.cls\n@@ -1,1 +1,1 @@\n-public class Fuga { }\n+public class Fuga {}\n", diffs[1].Diff)
+	assert.Equal(t, &ComponentDiff{Type: "ApexClass", Member: "Hoge", Status: DIFF_IDENTICAL}, diffs[2])
+	assert.Equal(t, &ComponentDiff{Type: "ApexClass", Member: "Piyo", Status: DIFF_MISSING}, diffs[3])
+}
+
+func TestCompareComponentsUnknownTypes(t *testing.T) {
+	files := []*File{
+		{Name: "unpackaged/package.xml", Body: newPackageXML([]*component{{Type: "QuickText", Member: "*"}}, "38.0").Bytes()},
+		{Name: "unpackaged/quickTexts/Hoge.quickText", Body: []byte("<QuickText><message>hoge</message></QuickText>")},
+		{Name: "unpackaged/quickTexts/Fuga.quickText", Body: []byte("<QuickText/>")},
+		{Name: "unpackaged/unknowns/Hoge.unknown", Body: []byte("<Unknown/>")},
+	}
+	orgFiles := []*File{
+		{Name: "unpackaged/package.xml", Body: newPackageXML([]*component{{Type: "QuickText", Member: "Hoge"}}, "38.0").Bytes()},
+		{Name: "unpackaged/quickTexts/Hoge.quickText", Body: []byte("<QuickText><message>fuga</message></QuickText>")},
+	}
+	diffs, skipped := compareComponents(files, orgFiles)
+	assert.Equal(t, []string{"unknowns/Hoge.unknown"}, skipped)
+	assert.Equal(t, 2, len(diffs))
+	assert.Equal(t, &ComponentDiff{Type: "QuickText", Member: "Fuga", Status: DIFF_MISSING}, diffs[0])
+	assert.Equal(t, "Hoge", diffs[1].Member)
+	assert.Equal(t, DIFF_CHANGED, diffs[1].Status)
+}
+
+func TestDiffWithOrg(t *testing.T) {
+	server := httptest.NewServer(NewMockServer(NewSpmLogger(ioutil.Discard, ioutil.Discard), nil))
+	defer server.Close()
+
+	installer := newMockInstaller(t, server.URL, mockPackageFiles)
+	assert.Nil(t, installer.Diff())
+	assert.Equal(t, []*ComponentDiff{{Type: "ApexClass", Member: "Hoge", Status: DIFF_MISSING}}, installer.result.Diffs)
+
+	assert.Nil(t, installer.Install())
+	assert.Nil(t, installer.Diff())
+	assert.Equal(t, []*ComponentDiff{{Type: "ApexClass", Member: "Hoge", Status: DIFF_IDENTICAL}}, installer.result.Diffs)
+}
@@ -2,16 +2,18 @@ package main
 
 import (
 	"bytes"
-	"encoding/base64"
 	"errors"
 	"fmt"
 	"io/ioutil"
 	"net/url"
+	"os"
 	"path/filepath"
 	"regexp"
-	"time"
+	"strconv"
+	"strings"
 
 	"gopkg.in/src-d/go-git.v4"
+	gitconfig "gopkg.in/src-d/go-git.v4/config"
 	"gopkg.in/src-d/go-git.v4/plumbing"
 	"gopkg.in/src-d/go-git.v4/plumbing/object"
 	"gopkg.in/src-d/go-git.v4/storage/memory"
@@ -23,11 +25,12 @@ type gitConfig struct {
 	uri string
 }
 type salesforceConfig struct {
-	username    string
-	password    string
-	endpoint    string
-	packagePath string
-	apiVersion  string
+	credentials
+	endpoint      string
+	packagePath   string
+	apiVersion    string
+	packageNames  []string
+	specificFiles []string
 }
 
 type Downloader interface {
@@ -35,8 +38,11 @@ type Downloader interface {
 }
 
 type MetaPackageFile struct {
-	Version float64 `toml:"version"`
-	Types   []*Type `toml:"types"`
+	Version       float64  `toml:"version"`
+	Types         []*Type  `toml:"types"`
+	Packages      []string `toml:"packages"`
+	SinglePackage bool     `toml:"single_package"`
+	Files         []string `toml:"files"`
 }
 
 type Type struct {
@@ -60,11 +66,8 @@ func NewSalesforceDownloader(logger Logger, config *salesforceConfig) (*Salesfor
 }
 
 func (d *SalesforceDownloader) init() (err error) {
-	if d.config.username == "" {
-		return errors.New("[Downloader] Username is required")
-	}
-	if d.config.password == "" {
-		return errors.New("[Downloader] Password is required")
+	if err = d.config.validate("Downloader"); err != nil {
+		return err
 	}
 
 	err = d.setClient()
@@ -76,7 +79,8 @@ func (d *SalesforceDownloader) init() (err error) {
 
 func (d *SalesforceDownloader) setClient() error {
 	d.client = NewForceClient(d.config.endpoint, d.config.apiVersion)
-	err := d.client.Login(d.config.username, d.config.password)
+	d.client.SetLogger(d.logger)
+	err := d.config.login(d.client)
 	if err != nil {
 		return err
 	}
@@ -84,39 +88,49 @@ func (d *SalesforceDownloader) setClient() error {
 }
 
 func (d *SalesforceDownloader) Download() ([]*File, error) {
-	buf, err := ioutil.ReadFile(d.config.packagePath)
+	packages, err := d.loadMetaPackageFile()
 	if err != nil {
 		return nil, err
 	}
-	packages := &MetaPackageFile{}
-	err = toml.Unmarshal(buf, packages)
+	request, err := createRetrieveRequest(packages)
 	if err != nil {
 		return nil, err
 	}
 	d.logger.Info("Start Retrieve Request...")
-	r, err := d.client.Retrieve(createRetrieveRequest(packages))
+	zip, err := d.client.RetrieveZip(request)
 	if err != nil {
 		return nil, err
 	}
-	for {
-		time.Sleep(2 * time.Second)
-		d.logger.Info("Check Retrieve Status...")
-		ret_res, err := d.client.CheckRetrieveStatus(r.Result.Id)
-		if err != nil {
+	return []*File{{Body: zip}}, nil
+}
+
+func (d *SalesforceDownloader) loadMetaPackageFile() (*MetaPackageFile, error) {
+	packages := &MetaPackageFile{}
+	buf, err := ioutil.ReadFile(d.config.packagePath)
+	if err != nil {
+		// package names or files given on the command line are enough to retrieve
+		if !os.IsNotExist(err) || (len(d.config.packageNames) == 0 && len(d.config.specificFiles) == 0) {
 			return nil, err
 		}
-		if ret_res.Result.Done {
-			zb := make([]byte, len(ret_res.Result.ZipFile))
-			_, err = base64.StdEncoding.Decode(zb, ret_res.Result.ZipFile)
-			return []*File{{Body: zb}}, err
+		packages.Version, err = strconv.ParseFloat(d.config.apiVersion, 64)
+		if err != nil {
+			return nil, err
 		}
+	} else if err = toml.Unmarshal(buf, packages); err != nil {
+		return nil, err
 	}
-	return nil, nil // Todo: error handling
+	packages.Packages = append(packages.Packages, d.config.packageNames...)
+	packages.Files = append(packages.Files, d.config.specificFiles...)
+	return packages, nil
 }
 
 type GitDownloader struct {
 	logger Logger
 	config *gitConfig
+	commit string
+	// repository and dir are the clone of the last Download, used to read other commits
+	repository *git.Repository
+	dir        string
 }
 
 func NewGitDownloader(logger Logger, config *gitConfig) (*GitDownloader, error) {
@@ -144,8 +158,85 @@ func (d *GitDownloader) Download() ([]*File, error) {
 
 	ref, _ := r.Head()
 	commit, _ := r.Commit(ref.Hash())
+	d.commit = ref.Hash().String()
+	d.repository = r
+	d.dir = dir
+
+	return filesOfCommit(commit, dir)
+}
+
+// DownloadCommit returns the files of the commit in the repository cloned by Download.
+// Other branches and tags are fetched if the commit is not in the cloned branch.
+func (d *GitDownloader) DownloadCommit(hash string) ([]*File, error) {
+	files, _, err := d.DownloadRef(hash)
+	return files, err
+}
+
+// DownloadRef returns the files and the commit hash of the ref (a branch, tag, commit hash or HEAD)
+// in the repository cloned by Download. Other branches and tags are fetched if the ref is not found.
+func (d *GitDownloader) DownloadRef(ref string) ([]*File, string, error) {
+	if d.repository == nil {
+		return nil, "", errors.New("Repository is not cloned")
+	}
+	commit, err := d.resolve(ref)
+	if err != nil {
+		d.logger.Infof("Fetch branches and tags to find %s", ref)
+		err = d.repository.Fetch(&git.FetchOptions{
+			RefSpecs: []gitconfig.RefSpec{"+refs/heads/*:refs/remotes/origin/*", "+refs/tags/*:refs/tags/*"},
+		})
+		if err != nil && err != git.NoErrAlreadyUpToDate {
+			return nil, "", err
+		}
+		commit, err = d.resolve(ref)
+		if err != nil {
+			return nil, "", fmt.Errorf("Commit %s is not found", ref)
+		}
+	}
+	files, err := filesOfCommit(commit, d.dir)
+	if err != nil {
+		return nil, "", err
+	}
+	return files, commit.Hash.String(), nil
+}
+
+var commitHashRegexp = regexp.MustCompile(`^[0-9a-f]{40}$`)
+
+// resolve returns the commit of the ref in the cloned repository.
+func (d *GitDownloader) resolve(ref string) (*object.Commit, error) {
+	if commitHashRegexp.MatchString(ref) {
+		return d.repository.Commit(plumbing.NewHash(ref))
+	}
+	names := []string{ref}
+	if !strings.HasPrefix(ref, "refs/") {
+		names = []string{"refs/heads/" + ref, "refs/tags/" + ref, "refs/remotes/origin/" + ref}
+	}
+	if ref == "HEAD" {
+		names = []string{"HEAD"}
+	}
+	for _, name := range names {
+		r, err := d.repository.Reference(plumbing.ReferenceName(name), true)
+		if err != nil {
+			continue
+		}
+		if commit, err := d.repository.Commit(r.Hash()); err == nil {
+			return commit, nil
+		}
+		// annotated tags refer to a tag object
+		tag, err := d.repository.Tag(r.Hash())
+		if err != nil {
+			return nil, err
+		}
+		return tag.Commit()
+	}
+	return nil, fmt.Errorf("Reference %s is not found", ref)
+}
 
+// filesOfCommit returns the files under dir of the commit, named relative to the unpackaged directory.
+func filesOfCommit(commit *object.Commit, dir string) ([]*File, error) {
 	gfiles, err := commit.Files()
+	if err != nil {
+		return nil, err
+	}
 	files := make([]*File, 0)
 	err = gfiles.ForEach(func(f *object.File) error {
 		reader, err := f.Reader()
@@ -175,6 +266,11 @@ func dispatchDownloader(logger Logger, uri string) (Downloader, error) {
 	if r.MatchString(uri) {
 		return NewGitDownloader(logger, &gitConfig{uri: uri})
 	}
+	r = regexp.MustCompile(`^sf://@([^/?]+)(\?(.+))?$`)
+	if r.MatchString(uri) {
+		group := r.FindAllStringSubmatch(uri, -1)
+		return newSalesforceDownloaderForOrg(logger, group[0][1], group[0][3])
+	}
 	r = regexp.MustCompile(`^sf://([^/]*?):([^/]*)@([^/]+?)(\?(.+))?$`)
 	if r.MatchString(uri) {
 		group := r.FindAllStringSubmatch(uri, -1)
@@ -183,8 +279,10 @@ func dispatchDownloader(logger Logger, uri string) (Downloader, error) {
 			return nil, err
 		}
 		return NewSalesforceDownloader(logger, &salesforceConfig{
-			username:    group[0][1],
-			password:    group[0][2],
+			credentials: credentials{
+				Username: group[0][1],
+				Password: group[0][2],
+			},
 			endpoint:    group[0][3],
 			packagePath: path,
 			apiVersion:  version,
@@ -193,6 +291,30 @@ func dispatchDownloader(logger Logger, uri string) (Downloader, error) {
 	return nil, errors.New("Invalid downloader")
 }
 
+func newSalesforceDownloaderForOrg(logger Logger, alias string, query string) (*SalesforceDownloader, error) {
+	org, err := loadOrgProfile(alias)
+	if err != nil {
+		return nil, err
+	}
+	creds, err := org.credentials(alias)
+	if err != nil {
+		return nil, err
+	}
+	path, version, err := parseQuery(query)
+	if err != nil {
+		return nil, err
+	}
+	if m, _ := url.ParseQuery(query); m.Get("version") == "" && org.ApiVersion != "" {
+		version = org.ApiVersion
+	}
+	return NewSalesforceDownloader(logger, &salesforceConfig{
+		credentials: *creds,
+		endpoint:    org.Endpoint,
+		packagePath: path,
+		apiVersion:  version,
+	})
+}
+
 func parseQuery(q string) (path string, version string, err error) {
 	m, err := url.ParseQuery(q)
 	if err != nil {
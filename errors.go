@@ -0,0 +1,127 @@
+package main
+
+import (
+	"bytes"
+	"fmt"
+)
+
+// Typed errors of SOAP faults. Error() returns the fault string as SOAPFault does.
+type InvalidLoginError struct {
+	*SOAPFault
+}
+
+type InvalidSessionError struct {
+	*SOAPFault
+}
+
+type InsufficientAccessError struct {
+	*SOAPFault
+}
+
+type UnsupportedApiVersionError struct {
+	*SOAPFault
+}
+
+type RequestLimitExceededError struct {
+	*SOAPFault
+}
+
+func newFaultError(f *SOAPFault) error {
+	switch f.ExceptionCode() {
+	case "INVALID_LOGIN", "LOGIN_MUST_USE_SECURITY_TOKEN", "PASSWORD_LOCKOUT", "INVALID_OPERATION_WITH_EXPIRED_PASSWORD":
+		return &InvalidLoginError{f}
+	case "INVALID_SESSION_ID":
+		return &InvalidSessionError{f}
+	case "INSUFFICIENT_ACCESS", "INSUFFICIENT_ACCESS_OR_READONLY", "API_DISABLED_FOR_ORG":
+		return &InsufficientAccessError{f}
+	case "UNSUPPORTED_API_VERSION":
+		return &UnsupportedApiVersionError{f}
+	case "REQUEST_LIMIT_EXCEEDED":
+		return &RequestLimitExceededError{f}
+	}
+	return f
+}
+
+// AuthenticationError is a failure to login to salesforce.
+type AuthenticationError struct {
+	error
+}
+
+// DownloadError is a failure to download a package from remote repository or salesforce.
+type DownloadError struct {
+	error
+}
+
+// DeployError is a deployment finished with component failures.
+type DeployError struct {
+	uri    string
+	result *DeployResult
+}
+
+func (e *DeployError) Error() string {
+	buf := new(bytes.Buffer)
+	fmt.Fprintf(buf, "%s: Deploy is failed", e.uri)
+	if e.result.ErrorMessage != "" {
+		fmt.Fprintf(buf, ": %s", e.result.ErrorMessage)
+	}
+	if e.result.Details == nil {
+		return buf.String()
+	}
+	for _, failure := range e.result.Details.ComponentFailures {
+		fmt.Fprintf(buf, "\n  %s %s", failure.ComponentType, failure.FullName)
+		if failure.LineNumber != 0 {
+			fmt.Fprintf(buf, " (line %d, column %d)", failure.LineNumber, failure.ColumnNumber)
+		}
+		fmt.Fprintf(buf, ": %s", failure.Problem)
+	}
+	return buf.String()
+}
+
+// TestFailureError is a deployment failed by apex test failures.
+type TestFailureError struct {
+	uri    string
+	result *DeployResult
+}
+
+func (e *TestFailureError) Error() string {
+	buf := new(bytes.Buffer)
+	fmt.Fprintf(buf, "%s: Deploy is failed by %d test failures", e.uri, e.result.NumberTestErrors)
+	if e.result.Details == nil || e.result.Details.RunTestResult == nil {
+		return buf.String()
+	}
+	for _, failure := range e.result.Details.RunTestResult.Failures {
+		fmt.Fprintf(buf, "\n  %s.%s: %s", failure.Name, failure.MethodName, failure.Message)
+	}
+	return buf.String()
+}
+
+func newDeployResultError(uri string, result *DeployResult) error {
+	if result.NumberTestErrors > 0 {
+		return &TestFailureError{uri: uri, result: result}
+	}
+	return &DeployError{uri: uri, result: result}
+}
+
+// DependencyError is a package not deployed since its dependency failed. The exit code is the one of the dependency's error.
+type DependencyError struct {
+	uri        string
+	dependency string
+	err        error
+}
+
+func (e *DependencyError) Error() string {
+	return fmt.Sprintf("%s: Dependency %s is not installed", e.uri, e.dependency)
+}
+
+type timeoutError struct {
+	uri string
+	// retrieveId is the id of the retrieve timed out. The deploy of uri is timed out if empty
+	retrieveId string
+}
+
+func (e *timeoutError) Error() string {
+	if e.retrieveId != "" {
+		return fmt.Sprintf("Retrieve is timeout. Please check retrieve status of %s", e.retrieveId)
+	}
+	return fmt.Sprintf("%s: Deploy is timeout. Please check release status for the deployment", e.uri)
+}
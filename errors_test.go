@@ -0,0 +1,60 @@
+package main
+
+import (
+	"errors"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestNewFaultError(t *testing.T) {
+	err := newFaultError(&SOAPFault{Code: "sf:INVALID_SESSION_ID", String: "INVALID_SESSION_ID: Invalid Session ID found in SessionHeader"})
+	_, ok := err.(*InvalidSessionError)
+	assert.True(t, ok)
+	assert.EqualError(t, err, "INVALID_SESSION_ID: Invalid Session ID found in SessionHeader")
+
+	err = newFaultError(&SOAPFault{Code: "sf:UNSUPPORTED_API_VERSION"})
+	_, ok = err.(*UnsupportedApiVersionError)
+	assert.True(t, ok)
+
+	err = newFaultError(&SOAPFault{Code: "sf:INVALID_TYPE"})
+	_, ok = err.(*SOAPFault)
+	assert.True(t, ok)
+}
+
+func TestDeployResultError(t *testing.T) {
+	err := newDeployResultError("tzmfreedom/hoge", &DeployResult{
+		Details: &DeployDetails{
+			ComponentFailures: []*DeployMessage{
+				{ComponentType: "ApexClass", FullName: "Hoge", LineNumber: 3, ColumnNumber: 5, Problem: "unexpected token: }"},
+			},
+		},
+	})
+	_, ok := err.(*DeployError)
+	assert.True(t, ok)
+	assert.EqualError(t, err, "tzmfreedom/hoge: Deploy is failed\n  ApexClass Hoge (line 3, column 5): unexpected token: }")
+
+	err = newDeployResultError("tzmfreedom/hoge", &DeployResult{
+		NumberTestErrors: 1,
+		Details: &DeployDetails{
+			RunTestResult: &RunTestsResult{
+				Failures: []*RunTestFailure{{Name: "HogeTest", MethodName: "testHoge", Message: "System.AssertException: Assertion Failed"}},
+			},
+		},
+	})
+	_, ok = err.(*TestFailureError)
+	assert.True(t, ok)
+	assert.EqualError(t, err, "tzmfreedom/hoge: Deploy is failed by 1 test failures\n  HogeTest.testHoge: System.AssertException: Assertion Failed")
+}
+
+func TestExitCode(t *testing.T) {
+	assert.Equal(t, ExitCodeOK, exitCode(nil))
+	assert.Equal(t, ExitCodeError, exitCode(errors.New("Repository not specified")))
+	assert.Equal(t, ExitCodeAuthError, exitCode(&AuthenticationError{errors.New("invalid_grant")}))
+	assert.Equal(t, ExitCodeAuthError, exitCode(&InvalidSessionError{&SOAPFault{}}))
+	assert.Equal(t, ExitCodeDownloadError, exitCode(&DownloadError{errors.New("repository not found")}))
+	assert.Equal(t, ExitCodeDeployError, exitCode(&DeployError{result: &DeployResult{}}))
+	assert.Equal(t, ExitCodeTestFailure, exitCode(&TestFailureError{result: &DeployResult{}}))
+	assert.Equal(t, ExitCodeTimeout, exitCode(&timeoutError{}))
+	assert.Equal(t, ExitCodeTestFailure, exitCode(&DependencyError{err: &TestFailureError{result: &DeployResult{}}}))
+}
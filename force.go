@@ -2,17 +2,58 @@ package main
 
 import (
 	"encoding/base64"
+	"errors"
 	"fmt"
+	"strings"
+	"time"
 )
 
 type ForceClient struct {
 	portType    *MetadataPortType
 	loginResult *LoginResult
+	endpoint    string
+	apiVersion  string
+	// session is shared with other clients of the same org, and renewed on INVALID_SESSION_ID
+	session      *Session
+	authenticate func(*ForceClient) error
+	// pollSeconds and timeoutSeconds are the interval and the timeout of polling retrieve results.
+	// Retrieves are waited until done if timeoutSeconds is 0
+	pollSeconds    int
+	timeoutSeconds int
+	logger         Logger
 }
 
 func NewForceClient(endpoint string, apiversion string) *ForceClient {
-	portType := NewMetadataPortType(fmt.Sprintf("https://%s/services/Soap/u/%s", endpoint, apiversion), true, nil)
-	return &ForceClient{portType: portType}
+	portType := NewMetadataPortType(fmt.Sprintf("%s/services/Soap/u/%s", endpointURL(endpoint), apiversion), true, nil)
+	return &ForceClient{
+		portType:    portType,
+		endpoint:    endpoint,
+		apiVersion:  apiversion,
+		pollSeconds: 2,
+	}
+}
+
+// endpointURL returns the base URL of the endpoint. https is used unless the scheme is given (i.g. http://localhost:8080).
+func endpointURL(endpoint string) string {
+	if strings.Contains(endpoint, "://") {
+		return strings.TrimRight(endpoint, "/")
+	}
+	return fmt.Sprintf("https://%s", endpoint)
+}
+
+// SetLogger enables tracing of SOAP requests and polling at debug level.
+func (client *ForceClient) SetLogger(logger Logger) {
+	client.logger = logger
+	client.portType.client.logger = logger
+}
+
+// SetPolling sets the interval and the timeout of polling retrieve results as --pollSeconds and --timeoutSeconds
+// do for deploys. The interval is kept if pollSeconds is 0.
+func (client *ForceClient) SetPolling(pollSeconds int, timeoutSeconds int) {
+	if pollSeconds > 0 {
+		client.pollSeconds = pollSeconds
+	}
+	client.timeoutSeconds = timeoutSeconds
 }
 
 func (client *ForceClient) Login(username string, password string) error {
@@ -25,60 +66,153 @@ func (client *ForceClient) Login(username string, password string) error {
 	return nil
 }
 
-func (client *ForceClient) Deploy(buf []byte) (*DeployResponse, error) {
-	request := Deploy{
-		ZipFile:       base64.StdEncoding.EncodeToString(buf),
-		DeployOptions: nil,
+// call sends the request by fn with the session. If the session is expired,
+// fn is called again after login.
+func (client *ForceClient) call(fn func() error) error {
+	loginResult := client.loginResult
+	client.setSession()
+	err := fn()
+	if _, ok := err.(*InvalidSessionError); !ok || client.session == nil {
+		return err
 	}
+	if err = client.session.Renew(client, loginResult); err != nil {
+		return err
+	}
+	client.setSession()
+	return fn()
+}
+
+func (client *ForceClient) setSession() {
 	sessionHeader := SessionHeader{
 		SessionId: client.loginResult.SessionId,
 	}
 	client.portType.SetHeader(&sessionHeader)
 	client.portType.SetServerUrl(client.loginResult.MetadataServerUrl)
+}
 
-	return client.portType.Deploy(&request)
+func (client *ForceClient) Deploy(buf []byte, options *DeployOptions) (response *DeployResponse, err error) {
+	request := Deploy{
+		ZipFile:       base64.StdEncoding.EncodeToString(buf),
+		DeployOptions: options,
+	}
+	err = client.call(func() error {
+		response, err = client.portType.Deploy(&request)
+		return err
+	})
+	return response, err
 }
 
-func (client *ForceClient) CheckDeployStatus(resultId *ID) (*CheckDeployStatusResponse, error) {
+func (client *ForceClient) CheckDeployStatus(resultId *ID) (response *CheckDeployStatusResponse, err error) {
 	check_request := CheckDeployStatus{AsyncProcessId: resultId, IncludeDetails: true}
-	return client.portType.CheckDeployStatus(&check_request)
+	err = client.call(func() error {
+		response, err = client.portType.CheckDeployStatus(&check_request)
+		return err
+	})
+	return response, err
 }
 
-func (client *ForceClient) Retrieve(request *Retrieve) (*RetrieveResponse, error) {
-	sessionHeader := SessionHeader{
-		SessionId: client.loginResult.SessionId,
-	}
-	client.portType.SetHeader(&sessionHeader)
-	client.portType.SetServerUrl(client.loginResult.MetadataServerUrl)
-	return client.portType.Retrieve(request)
+func (client *ForceClient) Retrieve(request *Retrieve) (response *RetrieveResponse, err error) {
+	err = client.call(func() error {
+		response, err = client.portType.Retrieve(request)
+		return err
+	})
+	return response, err
 }
 
-func (client *ForceClient) CheckRetrieveStatus(id *ID) (*CheckRetrieveStatusResponse, error) {
+func (client *ForceClient) CheckRetrieveStatus(id *ID) (response *CheckRetrieveStatusResponse, err error) {
 	request := CheckRetrieveStatus{
 		AsyncProcessId: id,
 	}
-	sessionHeader := SessionHeader{
-		SessionId: client.loginResult.SessionId,
+	err = client.call(func() error {
+		response, err = client.portType.CheckRetrieveStatus(&request)
+		return err
+	})
+	return response, err
+}
+
+func (client *ForceClient) ListMetadata(queries []*ListMetadataQuery) (response *ListMetadataResponse, err error) {
+	request := ListMetadata{Queries: queries}
+	err = client.call(func() error {
+		response, err = client.portType.ListMetadata(&request)
+		return err
+	})
+	return response, err
+}
+
+// RetrieveFiles retrieves the metadata and waits for the files of the result.
+func (client *ForceClient) RetrieveFiles(request *Retrieve) ([]*File, error) {
+	zip, err := client.RetrieveZip(request)
+	if err != nil {
+		return nil, err
 	}
-	client.portType.SetHeader(&sessionHeader)
-	client.portType.SetServerUrl(client.loginResult.MetadataServerUrl)
-	return client.portType.CheckRetrieveStatus(&request)
+	return unzipFiles(zip)
 }
 
-func createRetrieveRequest(metaPackageFile *MetaPackageFile) *Retrieve {
+// RetrieveZip retrieves the metadata and waits for the zip of the result.
+func (client *ForceClient) RetrieveZip(request *Retrieve) ([]byte, error) {
+	r, err := client.Retrieve(request)
+	if err != nil {
+		return nil, err
+	}
+	totalTime := 0
+	for {
+		if client.logger != nil {
+			client.logger.Debugf("Check Retrieve Status %s...", *r.Result.Id)
+		}
+		response, err := client.CheckRetrieveStatus(r.Result.Id)
+		if err != nil {
+			return nil, err
+		}
+		result := response.Result
+		if result.Done {
+			if result.Status != nil && *result.Status == RetrieveStatusFailed {
+				return nil, errors.New(result.ErrorMessage)
+			}
+			zb := make([]byte, base64.StdEncoding.DecodedLen(len(result.ZipFile)))
+			n, err := base64.StdEncoding.Decode(zb, result.ZipFile)
+			if err != nil {
+				return nil, err
+			}
+			return zb[:n], nil
+		}
+		if client.timeoutSeconds != 0 {
+			totalTime += client.pollSeconds
+			if totalTime > client.timeoutSeconds {
+				return nil, &timeoutError{retrieveId: string(*r.Result.Id)}
+			}
+		}
+		time.Sleep(time.Duration(client.pollSeconds) * time.Second)
+	}
+}
+
+func createRetrieveRequest(metaPackageFile *MetaPackageFile) (*Retrieve, error) {
+	if len(metaPackageFile.Files) > 0 && len(metaPackageFile.Packages) > 0 {
+		return nil, errors.New("Specific files and package names can not be retrieved at the same time")
+	}
+	if len(metaPackageFile.Types) == 0 && len(metaPackageFile.Packages) == 0 && len(metaPackageFile.Files) == 0 {
+		return nil, errors.New("Nothing to retrieve. Please specify types, packages or files")
+	}
 	request := &Retrieve{
 		RetrieveRequest: &RetrieveRequest{
-			ApiVersion: metaPackageFile.Version,
-			Unpackaged: &Package{},
+			ApiVersion:    metaPackageFile.Version,
+			PackageNames:  metaPackageFile.Packages,
+			SinglePackage: metaPackageFile.SinglePackage,
+			SpecificFiles: metaPackageFile.Files,
 		},
 	}
-	types := []*PackageTypeMembers{}
-	for _, metaType := range metaPackageFile.Types {
-		types = append(types, &PackageTypeMembers{
-			Name:    metaType.Name,
-			Members: metaType.Members,
-		})
+	if len(metaPackageFile.Files) > 0 {
+		// specificFiles requires singlePackage to be true
+		request.RetrieveRequest.SinglePackage = true
+	}
+	if len(metaPackageFile.Types) > 0 {
+		types := []*PackageTypeMembers{}
+		for _, metaType := range metaPackageFile.Types {
+			types = append(types, &PackageTypeMembers{
+				Name:    metaType.Name,
+				Members: metaType.Members,
+			})
+		}
+		request.RetrieveRequest.Unpackaged = &Package{Types: types}
 	}
-	request.RetrieveRequest.Unpackaged.Types = types
-	return request
+	return request, nil
 }
@@ -0,0 +1,50 @@
+package main
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestCreateRetrieveRequestUnpackaged(t *testing.T) {
+	request, err := createRetrieveRequest(&MetaPackageFile{
+		Version: 38.0,
+		Types:   []*Type{{Name: "ApexClass", Members: []string{"Hoge"}}},
+	})
+	assert.Nil(t, err)
+	assert.Equal(t, 38.0, request.RetrieveRequest.ApiVersion)
+	assert.Equal(t, "ApexClass", request.RetrieveRequest.Unpackaged.Types[0].Name)
+	assert.Nil(t, request.RetrieveRequest.PackageNames)
+}
+
+func TestCreateRetrieveRequestPackageNames(t *testing.T) {
+	request, err := createRetrieveRequest(&MetaPackageFile{
+		Version:  38.0,
+		Packages: []string{"HelloSpm"},
+	})
+	assert.Nil(t, err)
+	assert.Equal(t, []string{"HelloSpm"}, request.RetrieveRequest.PackageNames)
+	assert.Nil(t, request.RetrieveRequest.Unpackaged)
+}
+
+func TestCreateRetrieveRequestSpecificFiles(t *testing.T) {
+	request, err := createRetrieveRequest(&MetaPackageFile{
+		Version: 38.0,
+		Files:   []string{"classes/Hoge.cls"},
+	})
+	assert.Nil(t, err)
+	assert.Equal(t, []string{"classes/Hoge.cls"}, request.RetrieveRequest.SpecificFiles)
+	assert.True(t, request.RetrieveRequest.SinglePackage)
+}
+
+func TestCreateRetrieveRequestFailure(t *testing.T) {
+	_, err := createRetrieveRequest(&MetaPackageFile{Version: 38.0})
+	assert.EqualError(t, err, "Nothing to retrieve. Please specify types, packages or files")
+
+	_, err = createRetrieveRequest(&MetaPackageFile{
+		Version:  38.0,
+		Packages: []string{"HelloSpm"},
+		Files:    []string{"classes/Hoge.cls"},
+	})
+	assert.EqualError(t, err, "Specific files and package names can not be retrieved at the same time")
+}
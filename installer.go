@@ -14,20 +14,47 @@ type Installer interface {
 	Install() error
 }
 
-type timeoutError struct {
-	error
-}
-
 type config struct {
-	Username       string
-	Password       string
+	credentials
 	Endpoint       string
 	ApiVersion     string
 	PollSeconds    int
 	TimeoutSeconds int
 	PackageFile    string
 	IsCloneOnly    bool
+	IsPackOnly     bool
 	Directory      string
+	RulesFile      string
+	Org            string
+	CABundle       string
+	Insecure       bool
+	RequestTimeout int
+	Retries        int
+	CheckOnly      bool
+	Json           bool
+	Verbose        bool
+	Quiet          bool
+	LogLevel       string
+	LogFile        string
+	LogFormat      string
+	TraceSOAP      string
+	ReplaySOAP     string
+	SessionCache   int
+	// DestructiveTiming is "pre" or "post" to delete before or after the components of package.xml
+	DestructiveTiming string
+	PurgeOnDelete     bool
+	DryRun            bool
+	Cascade           bool
+	Jobs              int
+	// Yes applies the plan of upgrade
+	Yes bool
+	// Since and Diff deploy only the components changed from the ref, or between the refs of base..head
+	Since string
+	Diff  string
+	// Out is the directory to save the zips of --dry-run
+	Out string
+	// VendorDir is the directory of the packages vendored by spm vendor
+	VendorDir string
 }
 
 type SalesforceInstaller struct {
@@ -36,6 +63,12 @@ type SalesforceInstaller struct {
 	downloader Downloader
 	logger     Logger
 	uri        string
+	report     *CommandReport
+	result     *PackageResult
+	// registry is the packages installed in the org. The record of the package is deleted by uninstall
+	registry *Registry
+	// artifact collects the zip of the package instead of deploying it
+	artifact *Artifact
 }
 
 func NewSalesforceInstaller(logger Logger, downloader Downloader, config *config, uri string) (*SalesforceInstaller, error) {
@@ -45,19 +78,20 @@ func NewSalesforceInstaller(logger Logger, downloader Downloader, config *config
 		downloader: downloader,
 		uri:        uri,
 	}
+	if sd, ok := downloader.(*SalesforceDownloader); ok {
+		sd.client.SetPolling(config.PollSeconds, config.TimeoutSeconds)
+	}
 	err := i.init()
 	return i, err
 }
 
 func (i *SalesforceInstaller) init() (err error) {
-	if i.config.IsCloneOnly {
+	// dry runs and packs only build the zips without logging in
+	if i.config.IsCloneOnly || i.config.IsPackOnly || i.config.DryRun {
 		return nil
 	}
-	if i.config.Username == "" {
-		return errors.New("[Installer] Username is required")
-	}
-	if i.config.Password == "" {
-		return errors.New("[Installer] Password is required")
+	if err = i.config.validate("Installer"); err != nil {
+		return err
 	}
 
 	if !i.config.IsCloneOnly {
@@ -82,7 +116,9 @@ func (i *SalesforceInstaller) init() (err error) {
 
 func (i *SalesforceInstaller) setClient() error {
 	i.client = NewForceClient(i.config.Endpoint, i.config.ApiVersion)
-	err := i.client.Login(i.config.Username, i.config.Password)
+	i.client.SetLogger(i.logger)
+	i.client.SetPolling(i.config.PollSeconds, i.config.TimeoutSeconds)
+	err := i.config.login(i.client)
 	if err != nil {
 		return err
 	}
@@ -90,45 +126,128 @@ func (i *SalesforceInstaller) setClient() error {
 }
 
 func (i *SalesforceInstaller) Install() error {
+	i.result = NewPackageResult(i.uri)
+	err := i.install()
+	i.finish(err)
+	return err
+}
+
+// finish records the result of the package on the report.
+func (i *SalesforceInstaller) finish(err error) {
+	i.result.Finish(err)
+	if i.report != nil {
+		i.report.Add(i.result)
+	}
+}
+
+func (i *SalesforceInstaller) download() ([]*File, error) {
 	files, err := i.downloader.Download()
 	if err != nil {
+		return nil, &DownloadError{err}
+	}
+	switch d := i.downloader.(type) {
+	case *GitDownloader:
+		i.result.Commit = d.commit
+	case *VendorDownloader:
+		i.result.Commit = d.pkg.Commit
+	}
+	return files, nil
+}
+
+func (i *SalesforceInstaller) install() error {
+	files, err := i.download()
+	if err != nil {
+		return err
+	}
+	if err = i.loadDependencies(files); err != nil {
 		return err
 	}
-	if err = i.loadDependencies(i.uri, files); err != nil {
+	return i.deploy(files)
+}
+
+// deploy applies migration rules to the files of the package and deploys them
+// together with the registry record of the package.
+func (i *SalesforceInstaller) deploy(files []*File) (err error) {
+	dependencies, err := i.dependencies(files)
+	if err != nil {
 		return err
 	}
+	if i.config.RulesFile != "" {
+		files, err = i.migrate(files)
+		if err != nil {
+			return err
+		}
+	}
+	if !i.config.CheckOnly {
+		record := NewPackageRecord(i.uri, dependencies)
+		record.Commit = i.result.Commit
+		files, err = addRegistryRecord(files, record)
+		if err != nil {
+			return err
+		}
+	}
 
-	if _, ok := i.downloader.(*GitDownloader); ok {
+	if !isZipped(files) {
 		zc := NewZipConverter()
 		files, err = zc.Convert(files)
 		if err != nil {
 			return err
 		}
 	}
+	if i.artifact != nil {
+		return i.artifact.Add(i.uri, i.result.Commit, dependencies, files[0].Body)
+	}
+	return i.deployZip(files[0].Body)
+}
 
-	err = i.deployToSalesforce(files[0].Body)
-	if err != nil {
-		if _, ok := err.(timeoutError); ok {
-			errors.New(fmt.Sprintf("%s: Deploy is timeout. Please check release status for the deployment", i.uri))
-		}
-		return err
+// deployZip deploys the zip of the package, or shows the plan of it with --dry-run.
+func (i *SalesforceInstaller) deployZip(zip []byte) error {
+	var options *DeployOptions
+	if i.config.CheckOnly {
+		options = &DeployOptions{CheckOnly: true}
 	}
-	i.logger.Infof("%s: Deploy is successful", i.uri)
-	if err != nil {
+	if i.config.DryRun {
+		return i.plan(zip, options)
+	}
+	if err := i.deployToSalesforce(zip, options); err != nil {
 		return err
 	}
+	if i.config.CheckOnly {
+		i.logger.Infof("%s: Validation is successful", i.uri)
+	} else {
+		i.logger.Infof("%s: Deploy is successful", i.uri)
+	}
 
 	return nil
 }
 
-func (i *SalesforceInstaller) deployToSalesforce(bytes []byte) error {
-	response, err := i.client.Deploy(bytes)
+func (i *SalesforceInstaller) migrate(files []*File) ([]*File, error) {
+	rules, err := readMigrationRules(i.config.RulesFile)
+	if err != nil {
+		return nil, err
+	}
+	if isZipped(files) {
+		files, err = unzipFiles(files[0].Body)
+		if err != nil {
+			return nil, err
+		}
+	}
+	i.logger.Infof("%s: Apply migration rules %s", i.uri, i.config.RulesFile)
+	return NewMigrator(i.logger, rules).Migrate(files)
+}
+
+func (i *SalesforceInstaller) deployToSalesforce(bytes []byte, options *DeployOptions) error {
+	response, err := i.client.Deploy(bytes, options)
 
 	if err != nil {
 		return err
 	}
+	i.result.DeployId = string(*response.Result.Id)
 
-	err = i.checkDeployStatus(response.Result.Id)
+	result, err := i.checkDeployStatus(response.Result.Id)
+	if result != nil {
+		i.result.SetDeployResult(result)
+	}
 	if err != nil {
 		return err
 	}
@@ -136,7 +255,7 @@ func (i *SalesforceInstaller) deployToSalesforce(bytes []byte) error {
 	return nil
 }
 
-func (i *SalesforceInstaller) checkDeployStatus(resultId *ID) error {
+func (i *SalesforceInstaller) checkDeployStatus(resultId *ID) (*DeployResult, error) {
 	totalTime := 0
 	for {
 		time.Sleep(time.Duration(i.config.PollSeconds) * time.Second)
@@ -144,45 +263,60 @@ func (i *SalesforceInstaller) checkDeployStatus(resultId *ID) error {
 
 		response, err := i.client.CheckDeployStatus(resultId)
 		if err != nil {
-			return err
+			return nil, err
 		}
 		if response.Result.Done {
-			return nil
+			if !response.Result.Success {
+				return response.Result, newDeployResultError(i.uri, response.Result)
+			}
+			return response.Result, nil
 		}
 		if i.config.TimeoutSeconds != 0 {
 			totalTime += i.config.PollSeconds
 			if totalTime > i.config.TimeoutSeconds {
-				return timeoutError{}
+				return response.Result, &timeoutError{uri: i.uri}
 			}
 		}
 	}
 }
 
-func (i *SalesforceInstaller) loadDependencies(uri string, files []*File) error {
-	_, _, dir, _, err := extractInstallParameter(uri)
-	if err != nil {
-		return nil
+// dependencies returns the packages listed in package.yml of the package.
+func (i *SalesforceInstaller) dependencies(files []*File) ([]string, error) {
+	return packageDependencies(files)
+}
+
+// packageDependencies returns the URIs of the packages listed in package.yml of the files.
+func packageDependencies(files []*File) ([]string, error) {
+	if isZipped(files) {
+		return nil, nil
 	}
-	targetFile := filepath.Join(dir, "package.yml")
-	exists := false
 	for _, file := range files {
-		if file.Name == targetFile {
-			exists = true
-			break
+		if file.Name != filepath.Join("unpackaged", "package.yml") {
+			continue
 		}
+		packageFile, err := parsePackageFile(file.Body)
+		if err != nil {
+			return nil, err
+		}
+		uris := []string{}
+		for _, pkg := range packageFile.Packages {
+			uri, err := convertToUrl(pkg)
+			if err != nil {
+				return nil, err
+			}
+			uris = append(uris, uri)
+		}
+		return uris, nil
 	}
-	if exists == false {
-		return nil
-	}
-	packageFile, err := readPackageFile(targetFile)
+	return nil, nil
+}
+
+func (i *SalesforceInstaller) loadDependencies(files []*File) error {
+	uris, err := i.dependencies(files)
 	if err != nil {
 		return err
 	}
-	for _, pkg := range packageFile.Packages {
-		uri, err := convertToUrl(pkg)
-		if err != nil {
-			return err
-		}
+	for _, uri := range uris {
 		downloader, err := dispatchDownloader(i.logger, uri)
 		if err != nil {
 			return err
@@ -191,59 +325,134 @@ func (i *SalesforceInstaller) loadDependencies(uri string, files []*File) error
 		if err != nil {
 			return err
 		}
-		di.Install()
+		di.report = i.report
+		if err = di.Install(); err != nil {
+			return err
+		}
 	}
 	return nil
 }
 
 func (i *SalesforceInstaller) Uninstall() error {
-	files, err := i.downloader.Download()
-	if err != nil {
-		return err
-	}
+	i.result = NewPackageResult(i.uri)
+	err := i.uninstall()
+	i.finish(err)
+	return err
+}
 
-	files, err = createDestructiveChanges(files)
+func (i *SalesforceInstaller) uninstall() error {
+	files, err := i.download()
 	if err != nil {
 		return err
 	}
-
-	if _, ok := i.downloader.(*GitDownloader); ok {
-		zc := NewZipConverter()
-		files, err = zc.Convert(files)
+	if isZipped(files) {
+		files, err = unzipFiles(files[0].Body)
 		if err != nil {
 			return err
 		}
 	}
-
-	err = i.deployToSalesforce(files[0].Body)
+	components, skipped, err := destructiveComponents(files)
 	if err != nil {
-		if _, ok := err.(timeoutError); ok {
-			errors.New(fmt.Sprintf("%s: Deploy is timeout. Please check release status for the deployment", i.uri))
+		return err
+	}
+	for _, name := range skipped {
+		i.logger.Warningf("%s: %s is not deleted. The metadata type of the file is unknown. List it in package.xml", i.uri, name)
+	}
+	if i.registry != nil {
+		if record := i.registry.Get(i.uri); record != nil {
+			components = append(components, record.Component())
 		}
+	}
+
+	files, err = createDestructiveChanges(components, i.config.ApiVersion, i.config.DestructiveTiming)
+	if err != nil {
 		return err
 	}
-	i.logger.Infof("%s: Deploy is successful", i.uri)
+	zc := NewZipConverter()
+	files, err = zc.Convert(files)
 	if err != nil {
 		return err
 	}
 
+	options := &DeployOptions{
+		CheckOnly:     i.config.CheckOnly,
+		PurgeOnDelete: i.config.PurgeOnDelete,
+	}
+	if i.config.DryRun {
+		return i.plan(files[0].Body, options)
+	}
+	err = i.deployToSalesforce(files[0].Body, options)
+	if err != nil {
+		return err
+	}
+	i.logger.Infof("%s: Deploy is successful", i.uri)
+
 	return nil
 }
 
-func createDestructiveChanges(files []*File) ([]*File, error) {
+// destructiveComponents returns the components of package.xml sorted by type and member.
+// Wildcard members are replaced by the components found in the files of the package.
+// The files of unknown metadata types are returned as skipped.
+func destructiveComponents(files []*File) ([]*component, []string, error) {
+	var manifest *packageXML
+	resolver := newComponentResolver(files)
+	found := map[string][]*component{}
+	skipped := []string{}
 	for _, f := range files {
-		if f.Name == "unpackaged/package.xml" {
-			return []*File{
-				{
-					Name: "unpackaged/package.xml",
-					Body: []byte("<?xml version=\"1.0\" encoding=\"UTF-8\"?><Package xmlns=\"http://soap.sforce.com/2006/04/metadata\"><version>39.0</version></Package>"),
-				},
-				{
-					Name: "unpackaged/destructiveChanges.xml",
-					Body: f.Body,
-				},
-			}, nil
-		}
-	}
-	return nil, errors.New("Package.xml Not Found")
+		_, name := splitPackageRoot(f.Name)
+		if name == "package.xml" {
+			p, err := parsePackageXML(f.Body)
+			if err != nil {
+				return nil, nil, err
+			}
+			manifest = p
+			continue
+		}
+		c, ok := resolver.componentOf(name)
+		if !ok {
+			if isMetadataFile(name) {
+				skipped = append(skipped, name)
+			}
+			continue
+		}
+		found[c.Type] = append(found[c.Type], c)
+	}
+	if manifest == nil {
+		return nil, nil, errors.New("Package.xml Not Found")
+	}
+	components := []*component{}
+	for _, c := range manifest.Components() {
+		if c.Member == "*" {
+			components = append(components, found[c.Type]...)
+			continue
+		}
+		components = append(components, c)
+	}
+	return newPackageXML(components, "").Components(), skipped, nil
+}
+
+// createDestructiveChanges creates an empty package.xml of the api version and the manifest of components to delete.
+// timing selects destructiveChangesPre.xml ("pre"), destructiveChangesPost.xml ("post") or destructiveChanges.xml ("").
+func createDestructiveChanges(components []*component, version string, timing string) ([]*File, error) {
+	var name string
+	switch timing {
+	case "":
+		name = "destructiveChanges.xml"
+	case "pre":
+		name = "destructiveChangesPre.xml"
+	case "post":
+		name = "destructiveChangesPost.xml"
+	default:
+		return nil, fmt.Errorf("Invalid destructive timing: %s", timing)
+	}
+	return []*File{
+		{
+			Name: "unpackaged/package.xml",
+			Body: newPackageXML(nil, version).Bytes(),
+		},
+		{
+			Name: "unpackaged/" + name,
+			Body: newPackageXML(components, "").Bytes(),
+		},
+	}, nil
 }
@@ -0,0 +1,95 @@
+package main
+
+import (
+	"io/ioutil"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestDestructiveComponents(t *testing.T) {
+	files := []*File{
+		{Name: "unpackaged/package.xml", Body: newPackageXML([]*component{
+			{Type: "ApexClass", Member: "*"},
+			{Type: "CustomObject", Member: "Hoge__c"},
+		}, "38.0").Bytes()},
+		{Name: "unpackaged/classes/Fuga.cls", Body: []byte("public class Fuga {}")},
+		{Name: "unpackaged/classes/Fuga.cls-meta.xml", Body: []byte("<ApexClass/>")},
+		{Name: "unpackaged/classes/Hoge.cls", Body: []byte("public class Hoge {}")},
+		{Name: "unpackaged/package.yml", Body: []byte("packages: []")},
+	}
+	components, skipped, err := destructiveComponents(files)
+	assert.Nil(t, err)
+	assert.Equal(t, []*component{
+		{Type: "ApexClass", Member: "Fuga"},
+		{Type: "ApexClass", Member: "Hoge"},
+		{Type: "CustomObject", Member: "Hoge__c"},
+	}, components)
+	assert.Equal(t, 0, len(skipped))
+
+	_, _, err = destructiveComponents(files[1:])
+	assert.EqualError(t, err, "Package.xml Not Found")
+}
+
+func TestDestructiveComponentsUnknownTypes(t *testing.T) {
+	files := []*File{
+		{Name: "unpackaged/package.xml", Body: newPackageXML([]*component{{Type: "QuickText", Member: "*"}}, "38.0").Bytes()},
+		{Name: "unpackaged/quickTexts/Hoge.quickText", Body: []byte("<QuickText/>")},
+		{Name: "unpackaged/quickTexts/Fuga.quickText", Body: []byte("<QuickText/>")},
+		{Name: "unpackaged/unknowns/Hoge.unknown", Body: []byte("<Unknown/>")},
+	}
+	components, skipped, err := destructiveComponents(files)
+	assert.Nil(t, err)
+	assert.Equal(t, []*component{
+		{Type: "QuickText", Member: "Fuga"},
+		{Type: "QuickText", Member: "Hoge"},
+	}, components)
+	assert.Equal(t, []string{"unknowns/Hoge.unknown"}, skipped)
+}
+
+func TestCreateDestructiveChanges(t *testing.T) {
+	components := []*component{{Type: "ApexClass", Member: "Hoge"}}
+	files, err := createDestructiveChanges(components, "45.0", "post")
+	assert.Nil(t, err)
+	assert.Equal(t, "unpackaged/package.xml", files[0].Name)
+	p, err := parsePackageXML(files[0].Body)
+	assert.Nil(t, err)
+	assert.Equal(t, "45.0", p.Version)
+	assert.Equal(t, 0, len(p.Types))
+	assert.Equal(t, "unpackaged/destructiveChangesPost.xml", files[1].Name)
+	p, err = parsePackageXML(files[1].Body)
+	assert.Nil(t, err)
+	assert.Equal(t, components, p.Components())
+
+	files, err = createDestructiveChanges(components, "45.0", "")
+	assert.Nil(t, err)
+	assert.Equal(t, "unpackaged/destructiveChanges.xml", files[1].Name)
+
+	_, err = createDestructiveChanges(components, "45.0", "later")
+	assert.EqualError(t, err, "Invalid destructive timing: later")
+}
+
+func TestUninstall(t *testing.T) {
+	server := httptest.NewServer(NewMockServer(NewSpmLogger(ioutil.Discard, ioutil.Discard), nil))
+	defer server.Close()
+
+	installer := newMockInstaller(t, server.URL, mockPackageFiles)
+	assert.Nil(t, installer.Install())
+
+	installer.config.DryRun = true
+	assert.Nil(t, installer.Uninstall())
+	assert.Equal(t, map[string][]string{"ApexClass": {"Hoge"}}, installer.result.Plan.Delete)
+	assert.Equal(t, "destructiveChanges.xml", installer.result.Plan.DestructiveManifest)
+	list, err := installer.client.portType.ListMetadata(&ListMetadata{Queries: []*ListMetadataQuery{{Type_: "ApexClass"}}})
+	assert.Nil(t, err)
+	assert.Equal(t, 1, len(list.Result))
+
+	installer.config.DryRun = false
+	installer.config.DestructiveTiming = "pre"
+	installer.config.PurgeOnDelete = true
+	assert.Nil(t, installer.Uninstall())
+	list, err = installer.client.portType.ListMetadata(&ListMetadata{Queries: []*ListMetadataQuery{{Type_: "ApexClass"}}})
+	assert.Nil(t, err)
+	assert.Equal(t, 0, len(list.Result))
+}
@@ -1,12 +1,15 @@
 package main
 
 import (
+	"fmt"
 	"io"
 
 	"github.com/Sirupsen/logrus"
 )
 
 type Logger interface {
+	Debug(args ...interface{})
+	Debugf(format string, args ...interface{})
 	Info(args ...interface{})
 	Infof(format string, args ...interface{})
 	Warning(args ...interface{})
@@ -14,46 +17,95 @@ type Logger interface {
 	Error(args ...interface{})
 	Errorf(format string, args ...interface{})
 	Reset(outStream io.Writer, errStream io.Writer)
+	// WithField returns the logger adding the field to every message, i.g. the package of the message with --jobs
+	WithField(key string, value interface{}) Logger
 }
 
+// SpmLogger writes debug and info messages to OutLogger, warnings and errors to ErrLogger.
+// Every message is also written to FileLogger if a log file is set. Secrets are masked by redactHook.
 type SpmLogger struct {
-	OutLogger *logrus.Logger
-	ErrLogger *logrus.Logger
+	OutLogger  *logrus.Logger
+	ErrLogger  *logrus.Logger
+	FileLogger *logrus.Logger
+	fields     logrus.Fields
 }
 
 func NewSpmLogger(outStream io.Writer, errStream io.Writer) *SpmLogger {
 	outLogger := logrus.New()
 	outLogger.Out = outStream
+	outLogger.Hooks.Add(&redactHook{})
 	errLogger := logrus.New()
 	errLogger.Out = errStream
+	errLogger.Hooks.Add(&redactHook{})
 	return &SpmLogger{
 		OutLogger: outLogger,
 		ErrLogger: errLogger,
 	}
 }
 
+func (l *SpmLogger) Debug(args ...interface{}) {
+	l.OutLogger.WithFields(l.fields).Debug(args...)
+	if l.FileLogger != nil {
+		l.FileLogger.WithFields(l.fields).Debug(args...)
+	}
+}
+
+func (l *SpmLogger) Debugf(format string, args ...interface{}) {
+	l.OutLogger.WithFields(l.fields).Debugf(format, args...)
+	if l.FileLogger != nil {
+		l.FileLogger.WithFields(l.fields).Debugf(format, args...)
+	}
+}
+
 func (l *SpmLogger) Info(args ...interface{}) {
-	l.OutLogger.Info(args...)
+	l.OutLogger.WithFields(l.fields).Info(args...)
+	if l.FileLogger != nil {
+		l.FileLogger.WithFields(l.fields).Info(args...)
+	}
 }
 
 func (l *SpmLogger) Infof(format string, args ...interface{}) {
-	l.OutLogger.Infof(format, args...)
+	l.OutLogger.WithFields(l.fields).Infof(format, args...)
+	if l.FileLogger != nil {
+		l.FileLogger.WithFields(l.fields).Infof(format, args...)
+	}
 }
 
 func (l *SpmLogger) Warning(args ...interface{}) {
-	l.OutLogger.Warning(args...)
+	l.ErrLogger.WithFields(l.fields).Warning(args...)
+	if l.FileLogger != nil {
+		l.FileLogger.WithFields(l.fields).Warning(args...)
+	}
 }
 
 func (l *SpmLogger) Warningf(format string, args ...interface{}) {
-	l.OutLogger.Warningf(format, args...)
+	l.ErrLogger.WithFields(l.fields).Warningf(format, args...)
+	if l.FileLogger != nil {
+		l.FileLogger.WithFields(l.fields).Warningf(format, args...)
+	}
 }
 
 func (l *SpmLogger) Error(args ...interface{}) {
-	l.OutLogger.Error(args...)
+	l.ErrLogger.WithFields(l.fields).Error(args...)
+	if l.FileLogger != nil {
+		l.FileLogger.WithFields(l.fields).Error(args...)
+	}
 }
 
 func (l *SpmLogger) Errorf(format string, args ...interface{}) {
-	l.OutLogger.Errorf(format, args...)
+	l.ErrLogger.WithFields(l.fields).Errorf(format, args...)
+	if l.FileLogger != nil {
+		l.FileLogger.WithFields(l.fields).Errorf(format, args...)
+	}
+}
+
+func (l *SpmLogger) WithField(key string, value interface{}) Logger {
+	fields := logrus.Fields{}
+	for k, v := range l.fields {
+		fields[k] = v
+	}
+	fields[key] = value
+	return &SpmLogger{OutLogger: l.OutLogger, ErrLogger: l.ErrLogger, FileLogger: l.FileLogger, fields: fields}
 }
 
 func (l *SpmLogger) Reset(outStream io.Writer, errStream io.Writer) {
@@ -61,6 +113,51 @@ func (l *SpmLogger) Reset(outStream io.Writer, errStream io.Writer) {
 	l.ErrLogger.Out = errStream
 }
 
+// SetLevel changes the verbosity of the terminal output. The log file always records debug messages.
+func (l *SpmLogger) SetLevel(level string) error {
+	lv, err := logrus.ParseLevel(level)
+	if err != nil {
+		return fmt.Errorf("Invalid log level: %s", level)
+	}
+	l.OutLogger.Level = lv
+	l.ErrLogger.Level = lv
+	return nil
+}
+
+// SetFormat changes the format of all outputs to "text" or "json".
+func (l *SpmLogger) SetFormat(format string) error {
+	for _, logger := range []*logrus.Logger{l.OutLogger, l.ErrLogger, l.FileLogger} {
+		if logger == nil {
+			continue
+		}
+		formatter, err := newLogFormatter(format)
+		if err != nil {
+			return err
+		}
+		logger.Formatter = formatter
+	}
+	return nil
+}
+
+// SetLogFile writes every message to w in addition to the terminal.
+func (l *SpmLogger) SetLogFile(w io.Writer) {
+	fileLogger := logrus.New()
+	fileLogger.Out = w
+	fileLogger.Level = logrus.DebugLevel
+	fileLogger.Hooks.Add(&redactHook{})
+	l.FileLogger = fileLogger
+}
+
+func newLogFormatter(format string) (logrus.Formatter, error) {
+	switch format {
+	case "", "text":
+		return &logrus.TextFormatter{}, nil
+	case "json":
+		return &logrus.JSONFormatter{}, nil
+	}
+	return nil, fmt.Errorf("Invalid log format: %s", format)
+}
+
 type NullWriter struct {
 	Logger
 }
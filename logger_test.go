@@ -0,0 +1,54 @@
+package main
+
+import (
+	"bytes"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestSpmLogger(t *testing.T) {
+	outStream, errStream, fileStream := new(bytes.Buffer), new(bytes.Buffer), new(bytes.Buffer)
+	logger := NewSpmLogger(outStream, errStream)
+	logger.SetLogFile(fileStream)
+	assert.Nil(t, logger.SetLevel("info"))
+	assert.Nil(t, logger.SetFormat("json"))
+
+	logger.Debug("debug message")
+	logger.Info("info message")
+	logger.Warning("warning message")
+	logger.Error("error message")
+
+	assert.NotContains(t, outStream.String(), "debug message")
+	assert.Contains(t, outStream.String(), `"msg":"info message"`)
+	assert.NotContains(t, outStream.String(), "warning message")
+	assert.Contains(t, errStream.String(), "warning message")
+	assert.Contains(t, errStream.String(), "error message")
+	assert.Contains(t, fileStream.String(), "debug message")
+	assert.Contains(t, fileStream.String(), "error message")
+
+	assert.EqualError(t, logger.SetLevel("verbose"), "Invalid log level: verbose")
+	assert.EqualError(t, logger.SetFormat("xml"), "Invalid log format: xml")
+}
+
+func TestSpmLoggerWithField(t *testing.T) {
+	outStream := new(bytes.Buffer)
+	logger := NewSpmLogger(outStream, outStream)
+	assert.Nil(t, logger.SetFormat("json"))
+
+	logger.WithField("package", "sf://hoge:fuga@login.salesforce.com").Info("Start Retrieve Request...")
+	logger.Info("Summary")
+	lines := strings.Split(strings.TrimSpace(outStream.String()), "\n")
+	assert.Contains(t, lines[0], `"package":"sf://hoge:****@login.salesforce.com"`)
+	assert.NotContains(t, lines[1], `"package"`)
+}
+
+func TestTraceSOAPRequest(t *testing.T) {
+	outStream := new(bytes.Buffer)
+	logger := NewSpmLogger(outStream, outStream)
+	assert.Nil(t, logger.SetLevel("debug"))
+	id := ID("0Af000000000001")
+	traceSOAPRequest(logger, &CheckDeployStatus{AsyncProcessId: &id}, &CheckDeployStatusResponse{}, 0, nil)
+	assert.Contains(t, outStream.String(), "SOAP CheckDeployStatus (0s) asyncProcessId=0Af000000000001")
+}
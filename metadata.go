@@ -2,12 +2,13 @@ package main
 
 import (
 	"bytes"
-	"crypto/tls"
+	"context"
 	"encoding/xml"
-	"io/ioutil"
+	"fmt"
 	"log"
 	"net"
 	"net/http"
+	"strings"
 	"time"
 )
 
@@ -4510,7 +4511,8 @@ type UpsertMetadataResponse struct {
 }
 
 type CancelDeployResult struct {
-	XMLName xml.Name `xml:"http://soap.sforce.com/2006/04/metadata CancelDeployResult"`
+	// Modify
+	//	XMLName xml.Name `xml:"http://soap.sforce.com/2006/04/metadata CancelDeployResult"`
 
 	Done bool `xml:"done,omitempty"`
 
@@ -4624,11 +4626,11 @@ type RetrieveResult struct {
 
 	ErrorStatusCode *StatusCode `xml:"errorStatusCode,omitempty"`
 
-	FileProperties []*FileProperties `xml:"FileProperties,omitempty"`
+	FileProperties []*FileProperties `xml:"fileProperties,omitempty"`
 
 	Id string `xml:"id,omitempty"`
 
-	Messages []*RetrieveMessage `xml:"RetrieveMessages,omitempty"`
+	Messages []*RetrieveMessage `xml:"messages,omitempty"`
 
 	Status *RetrieveStatus `xml:"status,omitempty"`
 
@@ -4638,7 +4640,8 @@ type RetrieveResult struct {
 }
 
 type FileProperties struct {
-	XMLName xml.Name `xml:"http://soap.sforce.com/2006/04/metadata FileProperties"`
+	// Modify
+	//	XMLName xml.Name `xml:"http://soap.sforce.com/2006/04/metadata FileProperties"`
 
 	CreatedById string `xml:"createdById,omitempty"`
 
@@ -4666,7 +4669,8 @@ type FileProperties struct {
 }
 
 type RetrieveMessage struct {
-	XMLName xml.Name `xml:"http://soap.sforce.com/2006/04/metadata RetrieveMessage"`
+	// Modify
+	//	XMLName xml.Name `xml:"http://soap.sforce.com/2006/04/metadata RetrieveMessage"`
 
 	FileName string `xml:"fileName,omitempty"`
 
@@ -4694,7 +4698,8 @@ type RunTestsResult struct {
 }
 
 type CodeCoverageResult struct {
-	XMLName xml.Name `xml:"http://soap.sforce.com/2006/04/metadata CodeCoverageResult"`
+	// Modify
+	//	XMLName xml.Name `xml:"http://soap.sforce.com/2006/04/metadata CodeCoverageResult"`
 
 	DmlInfo []*CodeLocation `xml:"dmlInfo,omitempty"`
 
@@ -4732,7 +4737,8 @@ type CodeLocation struct {
 }
 
 type CodeCoverageWarning struct {
-	XMLName xml.Name `xml:"http://soap.sforce.com/2006/04/metadata CodeCoverageWarning"`
+	// Modify
+	//	XMLName xml.Name `xml:"http://soap.sforce.com/2006/04/metadata CodeCoverageWarning"`
 
 	Id *ID `xml:"id,omitempty"`
 
@@ -4744,7 +4750,8 @@ type CodeCoverageWarning struct {
 }
 
 type RunTestFailure struct {
-	XMLName xml.Name `xml:"http://soap.sforce.com/2006/04/metadata RunTestFailure"`
+	// Modify
+	//	XMLName xml.Name `xml:"http://soap.sforce.com/2006/04/metadata RunTestFailure"`
 
 	Id *ID `xml:"id,omitempty"`
 
@@ -4768,7 +4775,8 @@ type RunTestFailure struct {
 }
 
 type RunTestSuccess struct {
-	XMLName xml.Name `xml:"http://soap.sforce.com/2006/04/metadata RunTestSuccess"`
+	// Modify
+	//	XMLName xml.Name `xml:"http://soap.sforce.com/2006/04/metadata RunTestSuccess"`
 
 	Id *ID `xml:"id,omitempty"`
 
@@ -12789,7 +12797,8 @@ type AsyncResult struct {
 }
 
 type DescribeMetadataResult struct {
-	XMLName xml.Name `xml:"http://soap.sforce.com/2006/04/metadata DescribeMetadataResult"`
+	// Modify
+	//	XMLName xml.Name `xml:"http://soap.sforce.com/2006/04/metadata DescribeMetadataResult"`
 
 	MetadataObjects []*DescribeMetadataObject `xml:"metadataObjects,omitempty"`
 
@@ -12801,7 +12810,8 @@ type DescribeMetadataResult struct {
 }
 
 type DescribeMetadataObject struct {
-	XMLName xml.Name `xml:"http://soap.sforce.com/2006/04/metadata DescribeMetadataObject"`
+	// Modify
+	//	XMLName xml.Name `xml:"http://soap.sforce.com/2006/04/metadata DescribeMetadataObject"`
 
 	ChildXmlNames []string `xml:"childXmlNames,omitempty"`
 
@@ -12869,7 +12879,8 @@ type PicklistEntry struct {
 }
 
 type ListMetadataQuery struct {
-	XMLName xml.Name `xml:"http://soap.sforce.com/2006/04/metadata ListMetadataQuery"`
+	// Modify
+	//	XMLName xml.Name `xml:"http://soap.sforce.com/2006/04/metadata ListMetadataQuery"`
 
 	Folder string `xml:"folder,omitempty"`
 
@@ -13175,10 +13186,12 @@ type BasicAuth struct {
 }
 
 type SOAPClient struct {
-	url    string
-	tls    bool
-	auth   *BasicAuth
-	header interface{}
+	url        string
+	tls        bool
+	auth       *BasicAuth
+	header     interface{}
+	httpClient *http.Client
+	logger     Logger
 }
 
 func (b *SOAPBody) UnmarshalXML(d *xml.Decoder, start xml.StartElement) error {
@@ -13235,11 +13248,30 @@ func (f *SOAPFault) Error() string {
 	return f.String
 }
 
+// ExceptionCode returns the fault code without namespace prefix, i.g. INVALID_SESSION_ID
+func (f *SOAPFault) ExceptionCode() string {
+	code := f.Code
+	if i := strings.LastIndex(code, ":"); i >= 0 {
+		code = code[i+1:]
+	}
+	return code
+}
+
+// IsTransient reports whether the request may succeed by retrying.
+func (f *SOAPFault) IsTransient() bool {
+	switch f.ExceptionCode() {
+	case "UNKNOWN_EXCEPTION", "REQUEST_LIMIT_EXCEEDED", "SERVER_UNAVAILABLE":
+		return true
+	}
+	return false
+}
+
 func NewSOAPClient(url string, tls bool, auth *BasicAuth) *SOAPClient {
 	return &SOAPClient{
-		url:  url,
-		tls:  tls,
-		auth: auth,
+		url:        url,
+		tls:        tls,
+		auth:       auth,
+		httpClient: newHTTPClient(),
 	}
 }
 
@@ -13271,7 +13303,26 @@ func (s *SOAPClient) Call(soapAction string, request, response interface{}) erro
 		return err
 	}
 
-	req, err := http.NewRequest("POST", s.url, buffer)
+	policy := defaultRetryPolicy
+	if !isIdempotentRequest(request) {
+		policy = noRetryPolicy
+	}
+	start := time.Now()
+	err := policy.Do(func() error {
+		return s.call(soapAction, buffer.Bytes(), response)
+	})
+	if s.logger != nil {
+		traceSOAPRequest(s.logger, request, response, time.Since(start), err)
+	}
+	return err
+}
+
+func (s *SOAPClient) call(soapAction string, payload []byte, response interface{}) error {
+	body, err := gzipBytes(payload)
+	if err != nil {
+		return err
+	}
+	req, err := http.NewRequest("POST", s.url, bytes.NewReader(body))
 	if err != nil {
 		return err
 	}
@@ -13280,32 +13331,35 @@ func (s *SOAPClient) Call(soapAction string, request, response interface{}) erro
 	}
 
 	req.Header.Add("Content-Type", "text/xml; charset=\"utf-8\"")
+	req.Header.Add("Content-Encoding", "gzip")
+	req.Header.Add("Accept-Encoding", "gzip")
 	if soapAction != "" {
 		req.Header.Add("SOAPAction", soapAction)
 	}
 
 	req.Header.Set("User-Agent", "gowsdl/0.1")
-	req.Close = true
-
-	tr := &http.Transport{
-		TLSClientConfig: &tls.Config{
-			InsecureSkipVerify: s.tls,
-		},
-		Dial: dialTimeout,
-	}
 
-	client := &http.Client{Transport: tr}
-	res, err := client.Do(req)
+	ctx, cancel := context.WithTimeout(context.Background(), requestTimeout)
+	defer cancel()
+	res, err := s.httpClient.Do(req.WithContext(ctx))
 	if err != nil {
-		return err
+		return &retryableError{err}
 	}
 	defer res.Body.Close()
 
-	rawbody, err := ioutil.ReadAll(res.Body)
+	rawbody, err := readResponseBody(res)
 	if err != nil {
-		return err
+		return &retryableError{err}
+	}
+	if soapRecorder != nil {
+		if err := soapRecorder.Record(payload, rawbody); err != nil {
+			return err
+		}
 	}
 	if len(rawbody) == 0 {
+		if res.StatusCode >= http.StatusInternalServerError {
+			return &retryableError{fmt.Errorf("%s", res.Status)}
+		}
 		log.Println("empty response")
 		return nil
 	}
@@ -13314,12 +13368,18 @@ func (s *SOAPClient) Call(soapAction string, request, response interface{}) erro
 	respEnvelope.Body = SOAPBody{Content: response}
 	err = xml.Unmarshal(rawbody, respEnvelope)
 	if err != nil {
+		if res.StatusCode >= http.StatusInternalServerError {
+			return &retryableError{fmt.Errorf("%s", res.Status)}
+		}
 		return err
 	}
 
 	fault := respEnvelope.Body.Fault
 	if fault != nil {
-		return fault
+		if fault.IsTransient() {
+			return &retryableError{newFaultError(fault)}
+		}
+		return newFaultError(fault)
 	}
 
 	return nil
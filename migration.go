@@ -0,0 +1,230 @@
+package main
+
+import (
+	"path"
+	"path/filepath"
+	"sort"
+	"strings"
+
+	"github.com/BurntSushi/toml"
+)
+
+// MigrationRules are declarative rules applied to metadata between retrieve and deploy.
+type MigrationRules struct {
+	ApiVersion  string            `toml:"api_version"`
+	StripUsers  bool              `toml:"strip_users"`
+	MappingFile string            `toml:"mapping_file"`
+	Mapping     map[string]string `toml:"mapping"`
+	Drop        []*Type           `toml:"drop"`
+}
+
+type migrationMappingFile struct {
+	Mapping map[string]string `toml:"mapping"`
+}
+
+func readMigrationRules(rulesFile string) (*MigrationRules, error) {
+	rules := &MigrationRules{}
+	if _, err := toml.DecodeFile(rulesFile, rules); err != nil {
+		return nil, err
+	}
+	if rules.Mapping == nil {
+		rules.Mapping = map[string]string{}
+	}
+	if rules.MappingFile != "" {
+		mappingFile := rules.MappingFile
+		if !filepath.IsAbs(mappingFile) {
+			mappingFile = filepath.Join(filepath.Dir(rulesFile), mappingFile)
+		}
+		mapping := &migrationMappingFile{}
+		if _, err := toml.DecodeFile(mappingFile, mapping); err != nil {
+			return nil, err
+		}
+		for k, v := range mapping.Mapping {
+			rules.Mapping[k] = v
+		}
+	}
+	return rules, nil
+}
+
+type Migrator struct {
+	rules  *MigrationRules
+	logger Logger
+}
+
+func NewMigrator(logger Logger, rules *MigrationRules) *Migrator {
+	return &Migrator{
+		logger: logger,
+		rules:  rules,
+	}
+}
+
+// Migrate applies the rules to the files of metadata packages.
+func (m *Migrator) Migrate(files []*File) ([]*File, error) {
+	files = m.drop(files)
+	replacer := m.mappingReplacer()
+	for _, f := range files {
+		_, name := splitPackageRoot(f.Name)
+		if replacer != nil && isTextFile(name) {
+			f.Body = []byte(replacer.Replace(string(f.Body)))
+		}
+		if !strings.HasSuffix(name, ".xml") && !m.isUserReferenceFile(name) {
+			continue
+		}
+		body, err := m.transformXML(name, f.Body)
+		if err != nil {
+			return nil, err
+		}
+		f.Body = body
+	}
+	return files, nil
+}
+
+func (m *Migrator) drop(files []*File) []*File {
+	if len(m.rules.Drop) == 0 {
+		return files
+	}
+	migrated := []*File{}
+	for _, f := range files {
+		_, name := splitPackageRoot(f.Name)
+		if c, ok := componentOf(name); ok && m.isDropped(c) {
+			m.logger.Infof("Drop %s: %s", c.Type, c.Member)
+			continue
+		}
+		migrated = append(migrated, f)
+	}
+	return migrated
+}
+
+func (m *Migrator) isDropped(c *component) bool {
+	for _, rule := range m.rules.Drop {
+		if rule.Name != c.Type {
+			continue
+		}
+		for _, member := range rule.Members {
+			if ok, _ := path.Match(member, c.Member); ok {
+				return true
+			}
+		}
+	}
+	return false
+}
+
+func (m *Migrator) mappingReplacer() *strings.Replacer {
+	if len(m.rules.Mapping) == 0 {
+		return nil
+	}
+	keys := []string{}
+	for k := range m.rules.Mapping {
+		keys = append(keys, k)
+	}
+	// longer keys first, so 18 character ids win over their 15 character prefix
+	sort.Slice(keys, func(i, j int) bool {
+		if len(keys[i]) != len(keys[j]) {
+			return len(keys[i]) > len(keys[j])
+		}
+		return keys[i] < keys[j]
+	})
+	oldnew := []string{}
+	for _, k := range keys {
+		oldnew = append(oldnew, k, m.rules.Mapping[k])
+	}
+	return strings.NewReplacer(oldnew...)
+}
+
+func (m *Migrator) isUserReferenceFile(name string) bool {
+	return m.rules.StripUsers && (strings.HasPrefix(name, "workflows/") || strings.HasPrefix(name, "queues/"))
+}
+
+func (m *Migrator) transformXML(name string, body []byte) ([]byte, error) {
+	doc, err := parseXML(body)
+	if err != nil {
+		return nil, err
+	}
+	changed := false
+	if m.rules.ApiVersion != "" {
+		if name == "package.xml" {
+			changed = setChildText(doc.Root, "version", m.rules.ApiVersion) || changed
+		} else if strings.HasSuffix(name, "-meta.xml") {
+			changed = setChildText(doc.Root, "apiVersion", m.rules.ApiVersion) || changed
+		}
+	}
+	if name == "package.xml" && len(m.rules.Drop) > 0 {
+		changed = m.dropFromPackageXML(doc.Root) || changed
+	}
+	if m.isUserReferenceFile(name) {
+		changed = m.stripUsers(name, doc.Root) || changed
+	}
+	if !changed {
+		return body, nil
+	}
+	return doc.Bytes(), nil
+}
+
+func (m *Migrator) dropFromPackageXML(root *xmlNode) bool {
+	removed := 0
+	for _, types := range root.Children {
+		if types.Comment || types.Name != "types" {
+			continue
+		}
+		typeName := types.ChildText("name")
+		removed += types.RemoveChildren(func(n *xmlNode) bool {
+			return n.Name == "members" && m.isDropped(&component{Type: typeName, Member: strings.TrimSpace(n.Text)})
+		})
+	}
+	removed += root.RemoveChildren(func(n *xmlNode) bool {
+		return n.Name == "types" && n.Child("members") == nil
+	})
+	return removed > 0
+}
+
+// stripUsers removes references to users which do not exist in other organizations.
+func (m *Migrator) stripUsers(name string, root *xmlNode) bool {
+	removed := 0
+	if strings.HasPrefix(name, "workflows/") {
+		for _, alert := range root.Children {
+			if alert.Comment || alert.Name != "alerts" {
+				continue
+			}
+			removed += alert.RemoveChildren(func(n *xmlNode) bool {
+				return n.Name == "recipients" && n.ChildText("type") == "user"
+			})
+		}
+	}
+	if strings.HasPrefix(name, "queues/") {
+		removed += root.RemoveChildren(func(n *xmlNode) bool {
+			return n.Name == "users"
+		})
+		for _, members := range root.Children {
+			if members.Comment || members.Name != "queueMembers" {
+				continue
+			}
+			removed += members.RemoveChildren(func(n *xmlNode) bool {
+				return n.Name == "users"
+			})
+		}
+	}
+	if removed > 0 {
+		m.logger.Infof("Strip %d user references from %s", removed, name)
+	}
+	return removed > 0
+}
+
+func setChildText(n *xmlNode, name string, text string) bool {
+	child := n.Child(name)
+	if child == nil || child.Text == text {
+		return false
+	}
+	child.Text = text
+	return true
+}
+
+func isTextFile(name string) bool {
+	if strings.HasPrefix(name, "documents/") {
+		return strings.HasSuffix(name, "-meta.xml")
+	}
+	switch path.Ext(name) {
+	case ".resource", ".png", ".jpg", ".jpeg", ".gif", ".zip", ".pdf", ".ico":
+		return false
+	}
+	return true
+}
@@ -0,0 +1,85 @@
+package main
+
+import (
+	"io/ioutil"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+const MIGRATION_RULES_TOML = "./test/fixture/migration/rules.toml"
+
+func TestMigrate(t *testing.T) {
+	rules, err := readMigrationRules(MIGRATION_RULES_TOML)
+	assert.Nil(t, err)
+
+	files := []*File{
+		{
+			Name: "unpackaged/package.xml",
+			Body: []byte(`<?xml version="1.0" encoding="UTF-8"?>
+<Package xmlns="http://soap.sforce.com/2006/04/metadata">
+    <types>
+        <members>Hoge</members>
+        <name>ApexClass</name>
+    </types>
+    <types>
+        <members>Admin</members>
+        <name>Profile</name>
+    </types>
+    <version>38.0</version>
+</Package>
+`),
+		},
+		{
+			Name: "unpackaged/classes/Hoge.cls",
+			Body: []byte(`public class Hoge { Id ownerId = '00530000003xqAbAAI'; Id userId = '00530000003xqAb'; }`),
+		},
+		{
+			Name: "unpackaged/classes/Hoge.cls-meta.xml",
+			Body: []byte(`<?xml version="1.0" encoding="UTF-8"?>
+<ApexClass xmlns="http://soap.sforce.com/2006/04/metadata">
+    <apiVersion>38.0</apiVersion>
+    <status>Active</status>
+</ApexClass>
+`),
+		},
+		{
+			Name: "unpackaged/profiles/Admin.profile",
+			Body: []byte(`<?xml version="1.0" encoding="UTF-8"?><Profile xmlns="http://soap.sforce.com/2006/04/metadata"/>`),
+		},
+		{
+			Name: "unpackaged/workflows/Account.workflow",
+			Body: []byte(`<?xml version="1.0" encoding="UTF-8"?>
+<Workflow xmlns="http://soap.sforce.com/2006/04/metadata">
+    <alerts>
+        <fullName>Notify</fullName>
+        <recipients>
+            <recipient>admin@dev.example.com</recipient>
+            <type>user</type>
+        </recipients>
+        <recipients>
+            <type>owner</type>
+        </recipients>
+    </alerts>
+</Workflow>
+`),
+		},
+	}
+
+	files, err = NewMigrator(NewSpmLogger(ioutil.Discard, ioutil.Discard), rules).Migrate(files)
+	assert.Nil(t, err)
+	assert.Len(t, files, 4)
+	assert.Equal(t, `<?xml version="1.0" encoding="UTF-8"?>
+<Package xmlns="http://soap.sforce.com/2006/04/metadata">
+    <types>
+        <members>Hoge</members>
+        <name>ApexClass</name>
+    </types>
+    <version>41.0</version>
+</Package>
+`, string(files[0].Body))
+	assert.Equal(t, `public class Hoge { Id ownerId = '0056F000006xHkQQAU'; Id userId = '0056F000006xHkQ'; }`, string(files[1].Body))
+	assert.Contains(t, string(files[2].Body), "<apiVersion>41.0</apiVersion>")
+	assert.NotContains(t, string(files[3].Body), "admin@")
+	assert.Contains(t, string(files[3].Body), "<type>owner</type>")
+}
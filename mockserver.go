@@ -0,0 +1,559 @@
+package main
+
+import (
+	"compress/gzip"
+	"encoding/base64"
+	"encoding/xml"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"net/http"
+	"path"
+	"regexp"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/BurntSushi/toml"
+)
+
+const MOCK_ORGANIZATION_ID = "00D000000000001AAA"
+
+// MockScenario scripts the behaviour of MockServer.
+type MockScenario struct {
+	// Username and Password are required to login if set
+	Username string `toml:"username"`
+	Password string `toml:"password"`
+	// DeploySeconds is the time until a deployment is done
+	DeploySeconds int `toml:"deploy_seconds"`
+	// RetrieveSeconds is the time until a retrieve is done
+	RetrieveSeconds   int                     `toml:"retrieve_seconds"`
+	Faults            []*MockFault            `toml:"faults"`
+	ComponentFailures []*MockComponentFailure `toml:"component_failures"`
+	// TestFailures are reported by every deployment including apex classes or triggers
+	TestFailures []*MockTestFailure `toml:"test_failures"`
+}
+
+// MockFault answers requests of the operation by a SOAP fault (i.g. REQUEST_LIMIT_EXCEEDED).
+type MockFault struct {
+	Operation string `toml:"operation"`
+	Code      string `toml:"code"`
+	Message   string `toml:"message"`
+	// Count is the number of requests failing. Every request fails if 0
+	Count int `toml:"count"`
+}
+
+// MockComponentFailure fails deployments of the component. Name accepts path.Match patterns.
+type MockComponentFailure struct {
+	Type    string `toml:"type"`
+	Name    string `toml:"name"`
+	Problem string `toml:"problem"`
+	Line    int32  `toml:"line"`
+	Column  int32  `toml:"column"`
+}
+
+type MockTestFailure struct {
+	Class      string `toml:"class"`
+	Method     string `toml:"method"`
+	Message    string `toml:"message"`
+	StackTrace string `toml:"stack_trace"`
+}
+
+func readMockScenario(file string) (*MockScenario, error) {
+	scenario := &MockScenario{}
+	if _, err := toml.DecodeFile(file, scenario); err != nil {
+		return nil, err
+	}
+	return scenario, nil
+}
+
+type mockDeploy struct {
+	result    *DeployResult
+	files     map[string][]byte
+	deletes   []*component
+	startedAt time.Time
+	applied   bool
+}
+
+// MockServer is a fake Metadata API keeping deployed components in memory.
+// It implements login, deploy, checkDeployStatus, cancelDeploy, retrieve,
+// checkRetrieveStatus, listMetadata and describeMetadata.
+type MockServer struct {
+	logger    Logger
+	scenario  *MockScenario
+	mu        sync.Mutex
+	seq       int
+	sessions  map[string]bool
+	files     map[string][]byte
+	deploys   map[ID]*mockDeploy
+	retrieves map[string]*RetrieveResult
+	// retrievedAt is the time each retrieve is requested
+	retrievedAt map[string]time.Time
+	faults      map[*MockFault]int
+}
+
+func NewMockServer(logger Logger, scenario *MockScenario) *MockServer {
+	if scenario == nil {
+		scenario = &MockScenario{}
+	}
+	return &MockServer{
+		logger:      logger,
+		scenario:    scenario,
+		sessions:    map[string]bool{},
+		files:       map[string][]byte{},
+		deploys:     map[ID]*mockDeploy{},
+		retrieves:   map[string]*RetrieveResult{},
+		retrievedAt: map[string]time.Time{},
+		faults:      map[*MockFault]int{},
+	}
+}
+
+var sessionIdRegexp = regexp.MustCompile(`<(?:[a-zA-Z]+:)?sessionId>([^<]*)<`)
+
+func (s *MockServer) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	var reader io.Reader = r.Body
+	if r.Header.Get("Content-Encoding") == "gzip" {
+		zr, err := gzip.NewReader(r.Body)
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+		defer zr.Close()
+		reader = zr
+	}
+	body, err := ioutil.ReadAll(reader)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	operation := soapOperation(body)
+	s.logger.Infof("[MockServer] %s %s", operation, r.URL.Path)
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if fault := s.injectedFault(operation); fault != nil {
+		writeSOAPFault(w, fault.Code, fault.Message)
+		return
+	}
+	if operation != "login" {
+		m := sessionIdRegexp.FindSubmatch(body)
+		if m == nil || !s.sessions[string(m[1])] {
+			writeSOAPFault(w, "INVALID_SESSION_ID", "Invalid Session ID found in SessionHeader: Illegal Session")
+			return
+		}
+	}
+
+	var response interface{}
+	switch operation {
+	case "login":
+		request := &LoginRequest{}
+		if err = decodeSOAPRequest(body, request); err == nil {
+			response, err = s.login(r, request)
+		}
+	case "deploy":
+		request := &Deploy{}
+		if err = decodeSOAPRequest(body, request); err == nil {
+			response, err = s.deploy(request)
+		}
+	case "checkDeployStatus":
+		request := &CheckDeployStatus{}
+		if err = decodeSOAPRequest(body, request); err == nil {
+			response, err = s.checkDeployStatus(request)
+		}
+	case "cancelDeploy":
+		request := &CancelDeploy{}
+		if err = decodeSOAPRequest(body, request); err == nil {
+			response, err = s.cancelDeploy(request)
+		}
+	case "retrieve":
+		request := &Retrieve{}
+		if err = decodeSOAPRequest(body, request); err == nil {
+			response, err = s.retrieve(request)
+		}
+	case "checkRetrieveStatus":
+		request := &CheckRetrieveStatus{}
+		if err = decodeSOAPRequest(body, request); err == nil {
+			response, err = s.checkRetrieveStatus(request)
+		}
+	case "listMetadata":
+		request := &ListMetadata{}
+		if err = decodeSOAPRequest(body, request); err == nil {
+			response, err = s.listMetadata(request)
+		}
+	case "describeMetadata":
+		response, err = s.describeMetadata()
+	default:
+		err = &SOAPFault{Code: "sf:INVALID_OPERATION", String: fmt.Sprintf("INVALID_OPERATION: %s is not supported by mock server", operation)}
+	}
+	if err != nil {
+		if f, ok := err.(*SOAPFault); ok {
+			w.Header().Set("Content-Type", "text/xml; charset=utf-8")
+			w.WriteHeader(http.StatusInternalServerError)
+			writeSOAPEnvelope(w, &SOAPEnvelope{Body: SOAPBody{Fault: f}})
+			return
+		}
+		writeSOAPFault(w, "INVALID_OPERATION", err.Error())
+		return
+	}
+	w.Header().Set("Content-Type", "text/xml; charset=utf-8")
+	writeSOAPEnvelope(w, &SOAPEnvelope{Body: SOAPBody{Content: response}})
+}
+
+func (s *MockServer) injectedFault(operation string) *MockFault {
+	for _, fault := range s.scenario.Faults {
+		if fault.Operation != operation {
+			continue
+		}
+		if fault.Count > 0 && s.faults[fault] >= fault.Count {
+			continue
+		}
+		s.faults[fault]++
+		return fault
+	}
+	return nil
+}
+
+func (s *MockServer) nextId(prefix string) string {
+	s.seq++
+	return fmt.Sprintf("%s%012dAAA", prefix, s.seq)
+}
+
+func (s *MockServer) login(r *http.Request, request *LoginRequest) (*LoginResponse, error) {
+	if s.scenario.Username != "" && (request.Username != s.scenario.Username || request.Password != s.scenario.Password) {
+		return nil, &SOAPFault{Code: "sf:INVALID_LOGIN", String: "INVALID_LOGIN: Invalid username, password, security token; or user locked out."}
+	}
+	scheme := "http"
+	if r.TLS != nil {
+		scheme = "https"
+	}
+	version := path.Base(r.URL.Path)
+	sessionId := fmt.Sprintf("%s!%s", MOCK_ORGANIZATION_ID[:15], s.nextId("MOCK"))
+	s.sessions[sessionId] = true
+	userId := ID("005000000000001AAA")
+	return &LoginResponse{
+		LoginResult: LoginResult{
+			MetadataServerUrl: fmt.Sprintf("%s://%s/services/Soap/m/%s/%s", scheme, r.Host, version, MOCK_ORGANIZATION_ID),
+			ServerUrl:         fmt.Sprintf("%s://%s/services/Soap/u/%s/%s", scheme, r.Host, version, MOCK_ORGANIZATION_ID),
+			SessionId:         sessionId,
+			UserId:            &userId,
+		},
+	}, nil
+}
+
+func (s *MockServer) deploy(request *Deploy) (*DeployResponse, error) {
+	zb, err := base64.StdEncoding.DecodeString(request.ZipFile)
+	if err != nil {
+		return nil, err
+	}
+	files, err := unzipFiles(zb)
+	if err != nil {
+		return nil, err
+	}
+	id := ID(s.nextId("0Af"))
+	d := &mockDeploy{
+		files:     map[string][]byte{},
+		startedAt: time.Now(),
+	}
+	components := []*component{}
+	for _, f := range files {
+		_, name := splitPackageRoot(f.Name)
+		if strings.HasPrefix(name, "destructiveChanges") && strings.HasSuffix(name, ".xml") {
+			p, err := parsePackageXML(f.Body)
+			if err != nil {
+				return nil, err
+			}
+			d.deletes = append(d.deletes, p.Components()...)
+			components = append(components, p.Components()...)
+			continue
+		}
+		c, ok := componentOf(name)
+		if !ok {
+			continue
+		}
+		d.files[name] = f.Body
+		if !containsComponent(components, c) {
+			components = append(components, c)
+		}
+	}
+
+	status := DeployStatusSucceeded
+	result := &DeployResult{
+		Id:                    &id,
+		Done:                  true,
+		Status:                &status,
+		Success:               true,
+		CheckOnly:             request.DeployOptions != nil && request.DeployOptions.CheckOnly,
+		NumberComponentsTotal: int32(len(components)),
+		Details:               &DeployDetails{},
+	}
+	hasApex := false
+	for _, c := range components {
+		if c.Type == "ApexClass" || c.Type == "ApexTrigger" {
+			hasApex = true
+		}
+		if failure := s.componentFailure(c); failure != nil {
+			result.Details.ComponentFailures = append(result.Details.ComponentFailures, &DeployMessage{
+				ComponentType: c.Type,
+				FullName:      c.Member,
+				Problem:       failure.Problem,
+				LineNumber:    failure.Line,
+				ColumnNumber:  failure.Column,
+			})
+			continue
+		}
+		result.Details.ComponentSuccesses = append(result.Details.ComponentSuccesses, &DeployMessage{
+			ComponentType: c.Type,
+			FullName:      c.Member,
+			Success:       true,
+		})
+	}
+	result.NumberComponentErrors = int32(len(result.Details.ComponentFailures))
+	result.NumberComponentsDeployed = int32(len(result.Details.ComponentSuccesses))
+	if hasApex && len(s.scenario.TestFailures) > 0 {
+		testResult := &RunTestsResult{}
+		for _, f := range s.scenario.TestFailures {
+			testResult.Failures = append(testResult.Failures, &RunTestFailure{
+				Name:       f.Class,
+				MethodName: f.Method,
+				Message:    f.Message,
+				StackTrace: f.StackTrace,
+			})
+		}
+		testResult.NumFailures = int32(len(testResult.Failures))
+		testResult.NumTestsRun = testResult.NumFailures
+		result.Details.RunTestResult = testResult
+		result.NumberTestErrors = testResult.NumFailures
+		result.NumberTestsTotal = testResult.NumTestsRun
+		result.NumberTestsCompleted = testResult.NumTestsRun
+	}
+	if result.NumberComponentErrors > 0 || result.NumberTestErrors > 0 {
+		status = DeployStatusFailed
+		result.Success = false
+		result.NumberComponentsDeployed = 0
+	}
+	d.result = result
+	s.deploys[id] = d
+	return &DeployResponse{Result: &AsyncResult{Id: &id}}, nil
+}
+
+func (s *MockServer) componentFailure(c *component) *MockComponentFailure {
+	for _, f := range s.scenario.ComponentFailures {
+		if f.Type != "" && f.Type != c.Type {
+			continue
+		}
+		name := f.Name
+		if name == "" {
+			name = "*"
+		}
+		if ok, _ := path.Match(name, c.Member); ok {
+			return f
+		}
+	}
+	return nil
+}
+
+func (s *MockServer) checkDeployStatus(request *CheckDeployStatus) (*CheckDeployStatusResponse, error) {
+	d, err := s.findDeploy(request.AsyncProcessId)
+	if err != nil {
+		return nil, err
+	}
+	if !d.result.Done || d.applied {
+		return &CheckDeployStatusResponse{Result: d.result}, nil
+	}
+	if time.Since(d.startedAt) < time.Duration(s.scenario.DeploySeconds)*time.Second {
+		status := DeployStatusInProgress
+		return &CheckDeployStatusResponse{Result: &DeployResult{
+			Id:                    d.result.Id,
+			Status:                &status,
+			CheckOnly:             d.result.CheckOnly,
+			NumberComponentsTotal: d.result.NumberComponentsTotal,
+		}}, nil
+	}
+	d.applied = true
+	if d.result.Success && !d.result.CheckOnly {
+		for name, body := range d.files {
+			s.files[name] = body
+		}
+		for name := range s.files {
+			c, _ := componentOf(name)
+			if containsComponent(d.deletes, c) {
+				delete(s.files, name)
+			}
+		}
+	}
+	return &CheckDeployStatusResponse{Result: d.result}, nil
+}
+
+func (s *MockServer) cancelDeploy(request *CancelDeploy) (*CancelDeployResponse, error) {
+	d, err := s.findDeploy(request.String)
+	if err != nil {
+		return nil, err
+	}
+	if !d.applied {
+		status := DeployStatusCanceled
+		d.result.Status = &status
+		d.result.Success = false
+		d.applied = true
+	}
+	return &CancelDeployResponse{Result: &CancelDeployResult{Done: true, Id: d.result.Id}}, nil
+}
+
+func (s *MockServer) findDeploy(id *ID) (*mockDeploy, error) {
+	if id != nil {
+		if d, ok := s.deploys[*id]; ok {
+			return d, nil
+		}
+	}
+	return nil, &SOAPFault{Code: "sf:INVALID_ID_FIELD", String: "INVALID_ID_FIELD: Invalid deploy ID"}
+}
+
+func (s *MockServer) retrieve(request *Retrieve) (*RetrieveResponse, error) {
+	id := s.nextId("09S")
+	status := RetrieveStatusSucceeded
+	result := &RetrieveResult{Id: id, Done: true, Status: &status, Success: true}
+	s.retrieves[id] = result
+	s.retrievedAt[id] = time.Now()
+	r := request.RetrieveRequest
+	if r == nil || len(r.PackageNames) > 0 {
+		status = RetrieveStatusFailed
+		result.Success = false
+		result.ErrorMessage = "Retrieving packages is not supported by mock server"
+		return &RetrieveResponse{Result: &AsyncResult{Id: (*ID)(&id)}}, nil
+	}
+	requested := []*component{}
+	if r.Unpackaged != nil {
+		requested = (&packageXML{Types: r.Unpackaged.Types}).Components()
+	}
+	names := []string{}
+	for name := range s.files {
+		if containsString(r.SpecificFiles, name) {
+			names = append(names, name)
+			continue
+		}
+		c, _ := componentOf(name)
+		for _, req := range requested {
+			if req.Type == c.Type && (req.Member == "*" || req.Member == c.Member) {
+				names = append(names, name)
+				break
+			}
+		}
+	}
+	sort.Strings(names)
+	files := []*File{}
+	components := []*component{}
+	for _, name := range names {
+		c, _ := componentOf(name)
+		if !containsComponent(components, c) {
+			components = append(components, c)
+			result.FileProperties = append(result.FileProperties, &FileProperties{
+				FullName: c.Member,
+				Type_:    c.Type,
+				FileName: "unpackaged/" + name,
+			})
+		}
+		files = append(files, &File{Name: "unpackaged/" + name, Body: s.files[name]})
+	}
+	version := ""
+	if r.ApiVersion != 0 {
+		version = fmt.Sprintf("%.1f", r.ApiVersion)
+	}
+	files = append(files, &File{Name: "unpackaged/package.xml", Body: newPackageXML(components, version).Bytes()})
+	zipped, err := NewZipConverter().Convert(files)
+	if err != nil {
+		return nil, err
+	}
+	result.ZipFile = []byte(base64.StdEncoding.EncodeToString(zipped[0].Body))
+	return &RetrieveResponse{Result: &AsyncResult{Id: (*ID)(&id)}}, nil
+}
+
+func (s *MockServer) checkRetrieveStatus(request *CheckRetrieveStatus) (*CheckRetrieveStatusResponse, error) {
+	if request.AsyncProcessId != nil {
+		if result, ok := s.retrieves[string(*request.AsyncProcessId)]; ok {
+			if time.Since(s.retrievedAt[result.Id]) < time.Duration(s.scenario.RetrieveSeconds)*time.Second {
+				status := RetrieveStatusInProgress
+				return &CheckRetrieveStatusResponse{Result: &RetrieveResult{Id: result.Id, Status: &status}}, nil
+			}
+			return &CheckRetrieveStatusResponse{Result: result}, nil
+		}
+	}
+	return nil, &SOAPFault{Code: "sf:INVALID_ID_FIELD", String: "INVALID_ID_FIELD: Invalid retrieve ID"}
+}
+
+func (s *MockServer) listMetadata(request *ListMetadata) (*ListMetadataResponse, error) {
+	response := &ListMetadataResponse{}
+	names := make([]string, 0, len(s.files))
+	for name := range s.files {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	listed := []*component{}
+	for _, name := range names {
+		c, _ := componentOf(name)
+		if containsComponent(listed, c) {
+			continue
+		}
+		for _, q := range request.Queries {
+			if q.Type_ != c.Type {
+				continue
+			}
+			if q.Folder != "" && !strings.HasPrefix(c.Member, q.Folder+"/") {
+				continue
+			}
+			listed = append(listed, c)
+			response.Result = append(response.Result, &FileProperties{
+				FullName: c.Member,
+				Type_:    c.Type,
+				FileName: name,
+			})
+			break
+		}
+	}
+	return response, nil
+}
+
+func (s *MockServer) describeMetadata() (*DescribeMetadataResponse, error) {
+	result := &DescribeMetadataResult{}
+	for _, t := range metadataTypes {
+		result.MetadataObjects = append(result.MetadataObjects, &DescribeMetadataObject{
+			XmlName:       t.Name,
+			DirectoryName: t.Directory,
+			Suffix:        t.Suffix,
+			MetaFile:      t.MetaFile,
+			InFolder:      t.InFolder,
+		})
+	}
+	return &DescribeMetadataResponse{Result: result}, nil
+}
+
+func containsComponent(components []*component, c *component) bool {
+	if c == nil {
+		return false
+	}
+	for _, v := range components {
+		if v.Type == c.Type && v.Member == c.Member {
+			return true
+		}
+	}
+	return false
+}
+
+func decodeSOAPRequest(body []byte, request interface{}) error {
+	envelope := &SOAPEnvelope{Body: SOAPBody{Content: request}}
+	return xml.Unmarshal(body, envelope)
+}
+
+func writeSOAPEnvelope(w io.Writer, envelope *SOAPEnvelope) {
+	b, err := xml.Marshal(envelope)
+	if err != nil {
+		b = []byte(fmt.Sprintf(soapFaultEnvelope, "sf:UNKNOWN_EXCEPTION", err.Error()))
+	}
+	io.WriteString(w, xml.Header)
+	w.Write(b)
+}
+
+func writeSOAPFault(w http.ResponseWriter, code string, message string) {
+	w.Header().Set("Content-Type", "text/xml; charset=utf-8")
+	w.WriteHeader(http.StatusInternalServerError)
+	fmt.Fprintf(w, soapFaultEnvelope, "sf:"+code, fmt.Sprintf("%s: %s", code, message))
+}
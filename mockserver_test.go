@@ -0,0 +1,152 @@
+package main
+
+import (
+	"encoding/base64"
+	"io/ioutil"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func newMockInstaller(t *testing.T, endpoint string, files []*File) *SalesforceInstaller {
+	config := &config{
+		credentials: credentials{Username: "hoge@example.com", Password: "fuga"},
+		Endpoint:    endpoint,
+		ApiVersion:  "38.0",
+	}
+	installer, err := NewSalesforceInstaller(NewSpmLogger(ioutil.Discard, ioutil.Discard), &stubDownloader{files: files}, config, "https://github.com/tzmfreedom/hoge")
+	assert.Nil(t, err)
+	return installer
+}
+
+var mockPackageFiles = []*File{
+	{Name: "unpackaged/package.xml", Body: newPackageXML([]*component{{Type: "ApexClass", Member: "Hoge"}}, "38.0").Bytes()},
+	{Name: "unpackaged/classes/Hoge.cls", Body: []byte("public class Hoge {}")},
+	{Name: "unpackaged/classes/Hoge.cls-meta.xml", Body: []byte("<ApexClass/>")},
+}
+
+func TestMockServerDeployAndRetrieve(t *testing.T) {
+	server := httptest.NewServer(NewMockServer(NewSpmLogger(ioutil.Discard, ioutil.Discard), nil))
+	defer server.Close()
+
+	installer := newMockInstaller(t, server.URL, mockPackageFiles)
+	assert.Nil(t, installer.Install())
+	assert.Equal(t, "Succeeded", installer.result.Status)
+	assert.Equal(t, "Hoge", installer.result.ComponentSuccesses[0].FullName)
+
+	client := installer.client
+	list, err := client.portType.ListMetadata(&ListMetadata{Queries: []*ListMetadataQuery{{Type_: "ApexClass"}}})
+	assert.Nil(t, err)
+	assert.Equal(t, 1, len(list.Result))
+	assert.Equal(t, "Hoge", list.Result[0].FullName)
+
+	request, err := createRetrieveRequest(&MetaPackageFile{Version: 38.0, Types: []*Type{{Name: "ApexClass", Members: []string{"*"}}}})
+	assert.Nil(t, err)
+	r, err := client.Retrieve(request)
+	assert.Nil(t, err)
+	status, err := client.CheckRetrieveStatus(r.Result.Id)
+	assert.Nil(t, err)
+	assert.True(t, status.Result.Done)
+	zb, err := base64.StdEncoding.DecodeString(string(status.Result.ZipFile))
+	assert.Nil(t, err)
+	files, err := unzipFiles(zb)
+	assert.Nil(t, err)
+	names := []string{}
+	for _, f := range files {
+		names = append(names, f.Name)
+	}
+	assert.Equal(t, []string{"unpackaged/classes/Hoge.cls", "unpackaged/classes/Hoge.cls-meta.xml", "unpackaged/package.xml"}, names)
+
+	installer = newMockInstaller(t, server.URL, []*File{
+		{Name: "unpackaged/package.xml", Body: newPackageXML(nil, "38.0").Bytes()},
+		{Name: "unpackaged/destructiveChanges.xml", Body: newPackageXML([]*component{{Type: "ApexClass", Member: "Hoge"}}, "").Bytes()},
+	})
+	assert.Nil(t, installer.Install())
+	list, err = installer.client.portType.ListMetadata(&ListMetadata{Queries: []*ListMetadataQuery{{Type_: "ApexClass"}}})
+	assert.Nil(t, err)
+	assert.Equal(t, 0, len(list.Result))
+}
+
+func TestMockServerScenario(t *testing.T) {
+	scenario, err := readMockScenario("test/fixture/mock/scenario.toml")
+	assert.Nil(t, err)
+	server := httptest.NewServer(NewMockServer(NewSpmLogger(ioutil.Discard, ioutil.Discard), scenario))
+	defer server.Close()
+
+	installer := newMockInstaller(t, server.URL, mockPackageFiles)
+	err = installer.Install()
+	_, ok := err.(*RequestLimitExceededError)
+	assert.True(t, ok)
+
+	err = installer.Install()
+	_, ok = err.(*TestFailureError)
+	assert.True(t, ok)
+	assert.EqualError(t, err, "https://github.com/tzmfreedom/hoge: Deploy is failed by 1 test failures\n  HogeTest.testHoge: System.AssertException: Assertion Failed")
+
+	installer = newMockInstaller(t, server.URL, []*File{
+		{Name: "unpackaged/package.xml", Body: newPackageXML([]*component{{Type: "CustomObject", Member: "Fuga__c"}}, "38.0").Bytes()},
+		{Name: "unpackaged/objects/Fuga__c.object", Body: []byte("<CustomObject/>")},
+	})
+	err = installer.Install()
+	_, ok = err.(*DeployError)
+	assert.True(t, ok)
+	assert.Contains(t, err.Error(), "CustomObject Fuga__c: Field Name__c does not exist")
+
+	config := &config{
+		credentials: credentials{Username: "hoge@example.com", Password: "invalid"},
+		Endpoint:    server.URL,
+		ApiVersion:  "38.0",
+	}
+	_, err = NewSalesforceInstaller(NewSpmLogger(ioutil.Discard, ioutil.Discard), &stubDownloader{}, config, "")
+	_, ok = err.(*AuthenticationError)
+	assert.True(t, ok)
+}
+
+func TestMockServerSlowDeploy(t *testing.T) {
+	server := httptest.NewServer(NewMockServer(NewSpmLogger(ioutil.Discard, ioutil.Discard), &MockScenario{DeploySeconds: 60}))
+	defer server.Close()
+
+	installer := newMockInstaller(t, server.URL, nil)
+	zipped, err := NewZipConverter().Convert(mockPackageFiles)
+	assert.Nil(t, err)
+	response, err := installer.client.Deploy(zipped[0].Body, nil)
+	assert.Nil(t, err)
+	status, err := installer.client.CheckDeployStatus(response.Result.Id)
+	assert.Nil(t, err)
+	assert.False(t, status.Result.Done)
+	assert.Equal(t, DeployStatusInProgress, *status.Result.Status)
+
+	_, err = installer.client.portType.CancelDeploy(&CancelDeploy{String: response.Result.Id})
+	assert.Nil(t, err)
+	status, err = installer.client.CheckDeployStatus(response.Result.Id)
+	assert.Nil(t, err)
+	assert.Equal(t, DeployStatusCanceled, *status.Result.Status)
+}
+
+func TestMockServerRetrieveTimeout(t *testing.T) {
+	server := httptest.NewServer(NewMockServer(NewSpmLogger(ioutil.Discard, ioutil.Discard), &MockScenario{RetrieveSeconds: 10}))
+	defer server.Close()
+
+	logger := NewSpmLogger(ioutil.Discard, ioutil.Discard)
+	downloader, err := NewSalesforceDownloader(logger, &salesforceConfig{
+		credentials:   credentials{Username: "hoge@example.com", Password: "fuga"},
+		endpoint:      server.URL,
+		packagePath:   "not_found.toml",
+		apiVersion:    "38.0",
+		specificFiles: []string{"classes/Hoge.cls"},
+	})
+	assert.Nil(t, err)
+	config := &config{
+		credentials:    credentials{Username: "hoge@example.com", Password: "fuga"},
+		Endpoint:       server.URL,
+		ApiVersion:     "38.0",
+		PollSeconds:    1,
+		TimeoutSeconds: 1,
+	}
+	installer, err := NewSalesforceInstaller(logger, downloader, config, "sf://hoge@example.com:fuga@"+server.URL)
+	assert.Nil(t, err)
+	err = installer.Install()
+	assert.Equal(t, ExitCodeTimeout, exitCode(err))
+	assert.Contains(t, err.Error(), "Retrieve is timeout. Please check retrieve status of ")
+}
@@ -0,0 +1,161 @@
+package main
+
+import (
+	"bytes"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+)
+
+// metadataSortKeys are the elements sorted by normalizeMetadata per metadata type, and the child elements
+// identifying them. Elements are given by the path from the root element, i.g. picklistValues/values.
+// Elements whose order has a meaning (i.g. picklist values of a field, which are shown in the order) are kept.
+var metadataSortKeys = map[string]map[string][]string{
+	"Profile": {
+		"applicationVisibilities":    {"application"},
+		"categoryGroupVisibilities":  {"dataCategoryGroup"},
+		"classAccesses":              {"apexClass"},
+		"customMetadataTypeAccesses": {"name"},
+		"customPermissions":          {"name"},
+		"customSettingAccesses":      {"name"},
+		"externalDataSourceAccesses": {"externalDataSource"},
+		"fieldPermissions":           {"field"},
+		"flowAccesses":               {"flow"},
+		"layoutAssignments":          {"layout", "recordType"},
+		"loginIpRanges":              {"startAddress", "endAddress"},
+		"objectPermissions":          {"object"},
+		"pageAccesses":               {"apexPage"},
+		"profileActionOverrides":     {"actionName", "pageOrSobjectType", "recordType"},
+		"recordTypeVisibilities":     {"recordType"},
+		"tabVisibilities":            {"tab"},
+		"userPermissions":            {"name"},
+	},
+	"PermissionSet": {
+		"applicationVisibilities":    {"application"},
+		"classAccesses":              {"apexClass"},
+		"customMetadataTypeAccesses": {"name"},
+		"customPermissions":          {"name"},
+		"customSettingAccesses":      {"name"},
+		"externalDataSourceAccesses": {"externalDataSource"},
+		"fieldPermissions":           {"field"},
+		"flowAccesses":               {"flow"},
+		"objectPermissions":          {"object"},
+		"pageAccesses":               {"apexPage"},
+		"recordTypeVisibilities":     {"recordType"},
+		"tabSettings":                {"tab"},
+		"userPermissions":            {"name"},
+	},
+	"CustomObject": {
+		"actionOverrides":                   {"actionName", "formFactor"},
+		"businessProcesses":                 {"fullName"},
+		"compactLayouts":                    {"fullName"},
+		"fieldSets":                         {"fullName"},
+		"fields":                            {"fullName"},
+		"indexes":                           {"fullName"},
+		"listViews":                         {"fullName"},
+		"recordTypes":                       {"fullName"},
+		"sharingReasons":                    {"fullName"},
+		"validationRules":                   {"fullName"},
+		"webLinks":                          {"fullName"},
+		"recordTypes/picklistValues":        {"picklist"},
+		"recordTypes/picklistValues/values": {"fullName"},
+	},
+	"RecordType": {
+		"picklistValues":        {"picklist"},
+		"picklistValues/values": {"fullName"},
+	},
+	"CustomApplication": {
+		"actionOverrides":        {"actionName", "content", "formFactor", "pageOrSobjectType"},
+		"profileActionOverrides": {"actionName", "content", "formFactor", "pageOrSobjectType", "recordType", "profile"},
+	},
+}
+
+// metadataVolatileElements are removed by normalizeMetadata, since they change between retrieves
+// or orgs without the component being changed.
+var metadataVolatileElements = map[string][]string{
+	"Dashboard": {"runningUser"},
+}
+
+// normalizeMetadata normalizes a metadata file for stable diffs: line endings are unified,
+// elements are sorted by metadataSortKeys, metadataVolatileElements are removed,
+// and xml is indented as the metadata API writes it. name is relative to the package root, i.g. profiles/Admin.profile
+func normalizeMetadata(name string, body []byte) []byte {
+	body = bytes.Replace(body, []byte("\r\n"), []byte("\n"), -1)
+	if !bytes.HasPrefix(bytes.TrimSpace(body), []byte("<?xml")) {
+		return body
+	}
+	doc, err := parseXML(body)
+	if err != nil {
+		return body
+	}
+	if c, ok := componentOf(name); ok {
+		sortElements(doc.Root, "", metadataSortKeys[c.Type])
+		for _, element := range metadataVolatileElements[c.Type] {
+			doc.Root.RemoveChildren(func(n *xmlNode) bool { return n.Name == element })
+		}
+	}
+	return doc.Bytes()
+}
+
+// sortElements sorts each run of child elements of the same name which has sort keys, recursively.
+// The order of elements of different names is kept as the metadata API requires.
+func sortElements(n *xmlNode, path string, keys map[string][]string) {
+	if len(keys) == 0 {
+		return
+	}
+	for _, child := range n.Children {
+		if !child.Comment {
+			sortElements(child, strings.TrimPrefix(path+"/"+child.Name, "/"), keys)
+		}
+	}
+	for start := 0; start < len(n.Children); {
+		end := start + 1
+		for end < len(n.Children) && !n.Children[start].Comment && !n.Children[end].Comment && n.Children[end].Name == n.Children[start].Name {
+			end++
+		}
+		names, ok := keys[strings.TrimPrefix(path+"/"+n.Children[start].Name, "/")]
+		if ok && end-start > 1 {
+			run := n.Children[start:end]
+			sort.SliceStable(run, func(i, j int) bool {
+				for _, name := range names {
+					a, b := run[i].ChildText(name), run[j].ChildText(name)
+					if a != b {
+						return a < b
+					}
+				}
+				return false
+			})
+		}
+		start = end
+	}
+}
+
+// normalizeFiles normalizes the metadata files named with the package root, i.g. unpackaged/profiles/Admin.profile
+func normalizeFiles(files []*File) []*File {
+	normalized := []*File{}
+	for _, f := range files {
+		_, name := splitPackageRoot(f.Name)
+		normalized = append(normalized, &File{Name: f.Name, Body: normalizeMetadata(name, f.Body)})
+	}
+	return normalized
+}
+
+// unzipNormalized extracts the zip retrieved from salesforce to the directory, normalizing the metadata files.
+func unzipNormalized(buf []byte, dest string) error {
+	files, err := unzipFiles(buf)
+	if err != nil {
+		return err
+	}
+	for _, f := range normalizeFiles(files) {
+		path := filepath.Join(dest, f.Name)
+		if err := os.MkdirAll(filepath.Dir(path), 0755); err != nil {
+			return err
+		}
+		if err := ioutil.WriteFile(path, f.Body, 0644); err != nil {
+			return err
+		}
+	}
+	return nil
+}
@@ -0,0 +1,86 @@
+package main
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestNormalizeMetadata(t *testing.T) {
+	profile := `<?xml version="1.0" encoding="UTF-8"?>
+<Profile xmlns="http://soap.sforce.com/2006/04/metadata">
+  <classAccesses><apexClass>Fuga</apexClass><enabled>true</enabled></classAccesses>
+  <classAccesses><apexClass>Hoge</apexClass><enabled>true</enabled></classAccesses>
+  <fieldPermissions><editable>true</editable><field>Account.b__c</field></fieldPermissions>
+  <fieldPermissions><editable>true</editable><field>Account.a__c</field></fieldPermissions>
+  <custom>false</custom>
+</Profile>
+`
+	assert.Equal(t, `<?xml version="1.0" encoding="UTF-8"?>
+<Profile xmlns="http://soap.sforce.com/2006/04/metadata">
+    <classAccesses>
+        <apexClass>Fuga</apexClass>
+        <enabled>true</enabled>
+    </classAccesses>
+    <classAccesses>
+        <apexClass>Hoge</apexClass>
+        <enabled>true</enabled>
+    </classAccesses>
+    <fieldPermissions>
+        <editable>true</editable>
+        <field>Account.a__c</field>
+    </fieldPermissions>
+    <fieldPermissions>
+        <editable>true</editable>
+        <field>Account.b__c</field>
+    </fieldPermissions>
+    <custom>false</custom>
+</Profile>
+`, string(normalizeMetadata("profiles/Admin.profile", []byte(profile))))
+
+	object := `<?xml version="1.0" encoding="UTF-8"?>
+<CustomObject xmlns="http://soap.sforce.com/2006/04/metadata">
+    <fields>
+        <fullName>Status__c</fullName>
+        <valueSet>
+            <valueSetDefinition>
+                <value><fullName>New</fullName></value>
+                <value><fullName>Closed</fullName></value>
+            </valueSetDefinition>
+        </valueSet>
+    </fields>
+    <fields>
+        <fullName>Amount__c</fullName>
+    </fields>
+</CustomObject>
+`
+	normalized := string(normalizeMetadata("objects/Hoge__c.object", []byte(object)))
+	assert.True(t, strings.Index(normalized, "Amount__c") < strings.Index(normalized, "Status__c"))
+	// picklist values are kept in the order shown to users
+	assert.True(t, strings.Index(normalized, "New") < strings.Index(normalized, "Closed"))
+
+	dashboard := "<?xml version=\"1.0\" encoding=\"UTF-8\"?>\r\n<Dashboard><runningUser>hoge@example.com</runningUser><title>Hoge</title></Dashboard>\r\n"
+	assert.Equal(t, "<?xml version=\"1.0\" encoding=\"UTF-8\"?>\n<Dashboard>\n    <title>Hoge</title>\n</Dashboard>\n", string(normalizeMetadata("dashboards/Hoge/Hoge.dashboard", []byte(dashboard))))
+
+	assert.Equal(t, "public class Hoge {}\n", string(normalizeMetadata("classes/Hoge.cls", []byte("public class Hoge {}\r\n"))))
+}
+
+func TestUnzipNormalized(t *testing.T) {
+	dir, err := ioutil.TempDir("", "spm")
+	assert.Nil(t, err)
+	defer os.RemoveAll(dir)
+
+	zipped, err := NewZipConverter().Convert([]*File{
+		{Name: "unpackaged/package.xml", Body: newPackageXML([]*component{{Type: "Profile", Member: "Admin"}}, "38.0").Bytes()},
+		{Name: "unpackaged/profiles/Admin.profile", Body: []byte("<?xml version=\"1.0\" encoding=\"UTF-8\"?>\n<Profile><userPermissions><name>B</name></userPermissions><userPermissions><name>A</name></userPermissions></Profile>")},
+	})
+	assert.Nil(t, err)
+	assert.Nil(t, unzipNormalized(zipped[0].Body, dir))
+	buf, err := ioutil.ReadFile(filepath.Join(dir, "unpackaged", "profiles", "Admin.profile"))
+	assert.Nil(t, err)
+	assert.Equal(t, "<?xml version=\"1.0\" encoding=\"UTF-8\"?>\n<Profile>\n    <userPermissions>\n        <name>A</name>\n    </userPermissions>\n    <userPermissions>\n        <name>B</name>\n    </userPermissions>\n</Profile>\n", string(buf))
+}
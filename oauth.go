@@ -0,0 +1,136 @@
+package main
+
+import (
+	"crypto"
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/sha256"
+	"crypto/x509"
+	"encoding/base64"
+	"encoding/json"
+	"encoding/pem"
+	"errors"
+	"fmt"
+	"io/ioutil"
+	"net/url"
+	"strings"
+	"time"
+)
+
+const JWT_GRANT_TYPE = "urn:ietf:params:oauth:grant-type:jwt-bearer"
+
+type tokenResponse struct {
+	AccessToken      string `json:"access_token"`
+	InstanceUrl      string `json:"instance_url"`
+	Error            string `json:"error"`
+	ErrorDescription string `json:"error_description"`
+}
+
+// LoginWithJWT authenticates with OAuth 2.0 JWT bearer flow of the connected app.
+func (client *ForceClient) LoginWithJWT(tokenEndpoint string, clientId string, username string, key *rsa.PrivateKey) error {
+	assertion, err := createJWTAssertion(clientId, username, endpointURL(client.endpoint), key)
+	if err != nil {
+		return err
+	}
+	return client.requestToken(tokenEndpoint, url.Values{
+		"grant_type": {JWT_GRANT_TYPE},
+		"assertion":  {assertion},
+	})
+}
+
+// LoginWithRefreshToken authenticates with OAuth 2.0 refresh token flow.
+func (client *ForceClient) LoginWithRefreshToken(tokenEndpoint string, clientId string, clientSecret string, refreshToken string) error {
+	values := url.Values{
+		"grant_type":    {"refresh_token"},
+		"client_id":     {clientId},
+		"refresh_token": {refreshToken},
+	}
+	if clientSecret != "" {
+		values.Set("client_secret", clientSecret)
+	}
+	return client.requestToken(tokenEndpoint, values)
+}
+
+// LoginWithAccessToken uses the existing session without any request.
+func (client *ForceClient) LoginWithAccessToken(accessToken string, instanceUrl string) error {
+	instanceUrl = strings.TrimRight(instanceUrl, "/")
+	client.loginResult = &LoginResult{
+		SessionId:         accessToken,
+		ServerUrl:         fmt.Sprintf("%s/services/Soap/u/%s", instanceUrl, client.apiVersion),
+		MetadataServerUrl: fmt.Sprintf("%s/services/Soap/m/%s", instanceUrl, client.apiVersion),
+	}
+	return nil
+}
+
+func (client *ForceClient) requestToken(tokenEndpoint string, values url.Values) error {
+	if tokenEndpoint == "" {
+		tokenEndpoint = fmt.Sprintf("%s/services/oauth2/token", endpointURL(client.endpoint))
+	}
+	res, err := newHTTPClient().PostForm(tokenEndpoint, values)
+	if err != nil {
+		return err
+	}
+	defer res.Body.Close()
+	body, err := ioutil.ReadAll(res.Body)
+	if err != nil {
+		return err
+	}
+	token := &tokenResponse{}
+	if err = json.Unmarshal(body, token); err != nil {
+		return fmt.Errorf("Invalid token response: %s", res.Status)
+	}
+	if token.Error != "" {
+		return fmt.Errorf("%s: %s", token.Error, token.ErrorDescription)
+	}
+	if token.AccessToken == "" || token.InstanceUrl == "" {
+		return errors.New("Access token or instance url is not found in token response")
+	}
+	return client.LoginWithAccessToken(token.AccessToken, token.InstanceUrl)
+}
+
+func createJWTAssertion(clientId string, username string, audience string, key *rsa.PrivateKey) (string, error) {
+	header, err := json.Marshal(map[string]string{"alg": "RS256"})
+	if err != nil {
+		return "", err
+	}
+	claims, err := json.Marshal(map[string]interface{}{
+		"iss": clientId,
+		"sub": username,
+		"aud": audience,
+		"exp": time.Now().Add(3 * time.Minute).Unix(),
+	})
+	if err != nil {
+		return "", err
+	}
+	encoding := base64.RawURLEncoding
+	unsigned := encoding.EncodeToString(header) + "." + encoding.EncodeToString(claims)
+	hashed := sha256.Sum256([]byte(unsigned))
+	signature, err := rsa.SignPKCS1v15(rand.Reader, key, crypto.SHA256, hashed[:])
+	if err != nil {
+		return "", err
+	}
+	return unsigned + "." + encoding.EncodeToString(signature), nil
+}
+
+func readPrivateKey(keyFile string) (*rsa.PrivateKey, error) {
+	buf, err := ioutil.ReadFile(keyFile)
+	if err != nil {
+		return nil, err
+	}
+	block, _ := pem.Decode(buf)
+	if block == nil {
+		return nil, fmt.Errorf("%s: PEM encoded private key is not found", keyFile)
+	}
+	if key, err := x509.ParsePKCS1PrivateKey(block.Bytes); err == nil {
+		return key, nil
+	}
+	parsed, err := x509.ParsePKCS8PrivateKey(block.Bytes)
+	if err != nil {
+		return nil, err
+	}
+	key, ok := parsed.(*rsa.PrivateKey)
+	if !ok {
+		return nil, fmt.Errorf("%s: private key is not RSA", keyFile)
+	}
+	return key, nil
+}
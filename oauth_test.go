@@ -0,0 +1,77 @@
+package main
+
+import (
+	"crypto"
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestLoginWithRefreshToken(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		r.ParseForm()
+		assert.Equal(t, "refresh_token", r.PostForm.Get("grant_type"))
+		assert.Equal(t, "hoge", r.PostForm.Get("client_id"))
+		if r.PostForm.Get("refresh_token") != "valid" {
+			w.WriteHeader(http.StatusBadRequest)
+			fmt.Fprint(w, `{"error":"invalid_grant","error_description":"expired access/refresh token"}`)
+			return
+		}
+		fmt.Fprint(w, `{"access_token":"00Dxx!token","instance_url":"https://na1.salesforce.com"}`)
+	}))
+	defer server.Close()
+
+	client := NewForceClient("login.salesforce.com", "38.0")
+	err := client.LoginWithRefreshToken(server.URL, "hoge", "", "valid")
+	assert.Nil(t, err)
+	assert.Equal(t, "00Dxx!token", client.loginResult.SessionId)
+	assert.Equal(t, "https://na1.salesforce.com/services/Soap/m/38.0", client.loginResult.MetadataServerUrl)
+
+	err = client.LoginWithRefreshToken(server.URL, "hoge", "", "invalid")
+	assert.EqualError(t, err, "invalid_grant: expired access/refresh token")
+}
+
+func TestLoginWithJWT(t *testing.T) {
+	key, err := rsa.GenerateKey(rand.Reader, 2048)
+	assert.Nil(t, err)
+
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		r.ParseForm()
+		assert.Equal(t, JWT_GRANT_TYPE, r.PostForm.Get("grant_type"))
+		parts := strings.Split(r.PostForm.Get("assertion"), ".")
+		assert.Len(t, parts, 3)
+		claims := map[string]interface{}{}
+		b, _ := base64.RawURLEncoding.DecodeString(parts[1])
+		json.Unmarshal(b, &claims)
+		assert.Equal(t, "hoge", claims["iss"])
+		assert.Equal(t, "user@example.com", claims["sub"])
+		assert.Equal(t, "https://test.salesforce.com", claims["aud"])
+		hashed := sha256.Sum256([]byte(parts[0] + "." + parts[1]))
+		signature, _ := base64.RawURLEncoding.DecodeString(parts[2])
+		assert.Nil(t, rsa.VerifyPKCS1v15(&key.PublicKey, crypto.SHA256, hashed[:], signature))
+		fmt.Fprint(w, `{"access_token":"00Dxx!token","instance_url":"https://cs1.salesforce.com"}`)
+	}))
+	defer server.Close()
+
+	client := NewForceClient("test.salesforce.com", "38.0")
+	err = client.LoginWithJWT(server.URL, "hoge", "user@example.com", key)
+	assert.Nil(t, err)
+	assert.Equal(t, "https://cs1.salesforce.com/services/Soap/m/38.0", client.loginResult.MetadataServerUrl)
+}
+
+func TestLoginWithAccessToken(t *testing.T) {
+	client := NewForceClient("login.salesforce.com", "38.0")
+	err := client.LoginWithAccessToken("00Dxx!token", "https://na1.salesforce.com/")
+	assert.Nil(t, err)
+	assert.Equal(t, "00Dxx!token", client.loginResult.SessionId)
+	assert.Equal(t, "https://na1.salesforce.com/services/Soap/m/38.0", client.loginResult.MetadataServerUrl)
+}
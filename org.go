@@ -0,0 +1,258 @@
+package main
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"regexp"
+	"runtime"
+	"sort"
+	"strings"
+
+	"github.com/BurntSushi/toml"
+)
+
+const (
+	AUTH_PASSWORD      = "password"
+	AUTH_JWT           = "jwt"
+	AUTH_REFRESH_TOKEN = "refresh_token"
+	AUTH_ACCESS_TOKEN  = "access_token"
+)
+
+// OrgProfile is a named organization stored in ~/.spm/orgs.toml.
+// Secrets are never written to the file. They are resolved from password_env,
+// password_command or the encrypted secret store, in this order.
+type OrgProfile struct {
+	Endpoint        string `toml:"endpoint"`
+	Auth            string `toml:"auth"`
+	Username        string `toml:"username,omitempty"`
+	ApiVersion      string `toml:"api_version,omitempty"`
+	ClientId        string `toml:"client_id,omitempty"`
+	JwtKeyFile      string `toml:"jwt_key,omitempty"`
+	TokenEndpoint   string `toml:"token_endpoint,omitempty"`
+	InstanceUrl     string `toml:"instance_url,omitempty"`
+	PasswordEnv     string `toml:"password_env,omitempty"`
+	PasswordCommand string `toml:"password_command,omitempty"`
+}
+
+type orgsFile struct {
+	Orgs map[string]*OrgProfile `toml:"orgs"`
+}
+
+var orgAliasPattern = regexp.MustCompile(`^[A-Za-z0-9_.-]+$`)
+
+func spmHomeDir() string {
+	if dir := os.Getenv("SPM_HOME"); dir != "" {
+		return dir
+	}
+	home := os.Getenv("HOME")
+	if runtime.GOOS == "windows" {
+		home = os.Getenv("USERPROFILE")
+	}
+	return filepath.Join(home, ".spm")
+}
+
+func orgsFilePath() string {
+	return filepath.Join(spmHomeDir(), "orgs.toml")
+}
+
+func readOrgsFile() (*orgsFile, error) {
+	orgs := &orgsFile{}
+	if _, err := toml.DecodeFile(orgsFilePath(), orgs); err != nil && !os.IsNotExist(err) {
+		return nil, err
+	}
+	if orgs.Orgs == nil {
+		orgs.Orgs = map[string]*OrgProfile{}
+	}
+	return orgs, nil
+}
+
+func writeOrgsFile(orgs *orgsFile) error {
+	if err := os.MkdirAll(spmHomeDir(), 0700); err != nil {
+		return err
+	}
+	buf := new(bytes.Buffer)
+	if err := toml.NewEncoder(buf).Encode(orgs); err != nil {
+		return err
+	}
+	return writeFileAtomic(orgsFilePath(), buf.Bytes(), 0600)
+}
+
+func (o *orgsFile) Aliases() []string {
+	aliases := []string{}
+	for alias := range o.Orgs {
+		aliases = append(aliases, alias)
+	}
+	sort.Strings(aliases)
+	return aliases
+}
+
+func loadOrgProfile(alias string) (*OrgProfile, error) {
+	orgs, err := readOrgsFile()
+	if err != nil {
+		return nil, err
+	}
+	org, ok := orgs.Orgs[alias]
+	if !ok {
+		return nil, fmt.Errorf("Org alias not found: %s", alias)
+	}
+	return org, nil
+}
+
+func (org *OrgProfile) validate() error {
+	switch org.Auth {
+	case AUTH_PASSWORD, AUTH_ACCESS_TOKEN:
+	case AUTH_JWT:
+		if org.ClientId == "" || org.JwtKeyFile == "" {
+			return errors.New("Client ID and JWT key are required for jwt auth")
+		}
+	case AUTH_REFRESH_TOKEN:
+		if org.ClientId == "" {
+			return errors.New("Client ID is required for refresh_token auth")
+		}
+	default:
+		return fmt.Errorf("Unknown auth method: %s", org.Auth)
+	}
+	if org.Auth == AUTH_ACCESS_TOKEN && org.InstanceUrl == "" {
+		return errors.New("Instance URL is required for access_token auth")
+	}
+	return nil
+}
+
+// credentials resolves the secret of the organization and returns its credentials.
+func (org *OrgProfile) credentials(alias string) (*credentials, error) {
+	c := &credentials{
+		Username:      org.Username,
+		ClientId:      org.ClientId,
+		JwtKeyFile:    org.JwtKeyFile,
+		TokenEndpoint: org.TokenEndpoint,
+		InstanceUrl:   org.InstanceUrl,
+	}
+	if org.Auth == AUTH_JWT {
+		return c, nil
+	}
+	secret, err := org.resolveSecret(alias)
+	if err != nil {
+		return nil, err
+	}
+	switch org.Auth {
+	case AUTH_REFRESH_TOKEN:
+		c.RefreshToken = secret
+	case AUTH_ACCESS_TOKEN:
+		c.AccessToken = secret
+	default:
+		c.Password = secret
+	}
+	return c, nil
+}
+
+func (org *OrgProfile) resolveSecret(alias string) (string, error) {
+	if org.PasswordEnv != "" {
+		if secret := os.Getenv(org.PasswordEnv); secret != "" {
+			return secret, nil
+		}
+	}
+	if org.PasswordCommand != "" {
+		return runPasswordCommand(org.PasswordCommand)
+	}
+	store := NewSecretStore()
+	if store.Exists() {
+		secrets, err := store.Load()
+		if err != nil {
+			return "", err
+		}
+		if secret, ok := secrets[alias]; ok {
+			return secret, nil
+		}
+	}
+	return "", fmt.Errorf("Secret of org %s is not found. Please set password_env or password_command, or store it by `spm org add --store`", alias)
+}
+
+func runPasswordCommand(command string) (string, error) {
+	var cmd *exec.Cmd
+	if runtime.GOOS == "windows" {
+		cmd = exec.Command("cmd", "/C", command)
+	} else {
+		cmd = exec.Command("sh", "-c", command)
+	}
+	cmd.Stderr = os.Stderr
+	out, err := cmd.Output()
+	if err != nil {
+		return "", fmt.Errorf("password_command failed: %s", err)
+	}
+	return strings.TrimRight(string(out), "\r\n"), nil
+}
+
+// applyOrg overwrites the connection settings with the named organization.
+func (c *config) applyOrg(alias string) error {
+	org, err := loadOrgProfile(alias)
+	if err != nil {
+		return err
+	}
+	creds, err := org.credentials(alias)
+	if err != nil {
+		return err
+	}
+	c.credentials = *creds
+	if org.Endpoint != "" {
+		c.Endpoint = org.Endpoint
+	}
+	if org.ApiVersion != "" {
+		c.ApiVersion = org.ApiVersion
+	}
+	return nil
+}
+
+func addOrg(alias string, org *OrgProfile, secret string) error {
+	if !orgAliasPattern.MatchString(alias) {
+		return fmt.Errorf("Invalid org alias: %s", alias)
+	}
+	if err := org.validate(); err != nil {
+		return err
+	}
+	orgs, err := readOrgsFile()
+	if err != nil {
+		return err
+	}
+	if secret != "" {
+		store := NewSecretStore()
+		secrets, err := store.Load()
+		if err != nil {
+			return err
+		}
+		secrets[alias] = secret
+		if err = store.Save(secrets); err != nil {
+			return err
+		}
+	}
+	orgs.Orgs[alias] = org
+	return writeOrgsFile(orgs)
+}
+
+func removeOrg(alias string) error {
+	orgs, err := readOrgsFile()
+	if err != nil {
+		return err
+	}
+	if _, ok := orgs.Orgs[alias]; !ok {
+		return fmt.Errorf("Org alias not found: %s", alias)
+	}
+	delete(orgs.Orgs, alias)
+	store := NewSecretStore()
+	if store.Exists() {
+		secrets, err := store.Load()
+		if err != nil {
+			return err
+		}
+		if _, ok := secrets[alias]; ok {
+			delete(secrets, alias)
+			if err = store.Save(secrets); err != nil {
+				return err
+			}
+		}
+	}
+	return writeOrgsFile(orgs)
+}
@@ -0,0 +1,95 @@
+package main
+
+import (
+	"io/ioutil"
+	"os"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func withSpmHome(t *testing.T) func() {
+	dir, err := ioutil.TempDir("", "spm")
+	assert.Nil(t, err)
+	os.Setenv("SPM_HOME", dir)
+	return func() {
+		os.Unsetenv("SPM_HOME")
+		os.RemoveAll(dir)
+	}
+}
+
+func TestOrgPasswordEnv(t *testing.T) {
+	defer withSpmHome(t)()
+	os.Setenv("SPM_TEST_PASSWORD", "fuga")
+	defer os.Unsetenv("SPM_TEST_PASSWORD")
+
+	err := addOrg("uat", &OrgProfile{
+		Endpoint:    "test.salesforce.com",
+		Auth:        AUTH_PASSWORD,
+		Username:    "hoge@example.com",
+		ApiVersion:  "40.0",
+		PasswordEnv: "SPM_TEST_PASSWORD",
+	}, "")
+	assert.Nil(t, err)
+
+	config := &config{Endpoint: "login.salesforce.com", ApiVersion: "38.0"}
+	assert.Nil(t, config.applyOrg("uat"))
+	assert.Equal(t, "hoge@example.com", config.Username)
+	assert.Equal(t, "fuga", config.Password)
+	assert.Equal(t, "test.salesforce.com", config.Endpoint)
+	assert.Equal(t, "40.0", config.ApiVersion)
+
+	buf, err := ioutil.ReadFile(orgsFilePath())
+	assert.Nil(t, err)
+	assert.NotContains(t, string(buf), "fuga")
+
+	assert.Nil(t, removeOrg("uat"))
+	assert.EqualError(t, config.applyOrg("uat"), "Org alias not found: uat")
+}
+
+func TestOrgPasswordCommand(t *testing.T) {
+	defer withSpmHome(t)()
+
+	err := addOrg("dev", &OrgProfile{
+		Endpoint:        "login.salesforce.com",
+		Auth:            AUTH_REFRESH_TOKEN,
+		ClientId:        "hoge",
+		PasswordCommand: "echo token",
+	}, "")
+	assert.Nil(t, err)
+
+	config := &config{}
+	assert.Nil(t, config.applyOrg("dev"))
+	assert.Equal(t, "token", config.RefreshToken)
+	assert.Equal(t, "hoge", config.ClientId)
+}
+
+func TestOrgSecretStore(t *testing.T) {
+	defer withSpmHome(t)()
+	os.Setenv("SPM_PASSPHRASE", "passphrase")
+	defer os.Unsetenv("SPM_PASSPHRASE")
+
+	err := addOrg("prod", &OrgProfile{
+		Endpoint: "login.salesforce.com",
+		Auth:     AUTH_PASSWORD,
+		Username: "hoge@example.com",
+	}, "secret")
+	assert.Nil(t, err)
+
+	buf, err := ioutil.ReadFile(NewSecretStore().path)
+	assert.Nil(t, err)
+	assert.NotContains(t, string(buf), "secret")
+
+	config := &config{}
+	assert.Nil(t, config.applyOrg("prod"))
+	assert.Equal(t, "secret", config.Password)
+
+	os.Setenv("SPM_PASSPHRASE", "wrong")
+	assert.EqualError(t, config.applyOrg("prod"), "Failed to unlock secret store. Passphrase may be incorrect")
+}
+
+func TestOrgInvalid(t *testing.T) {
+	defer withSpmHome(t)()
+	assert.EqualError(t, addOrg("a/b", &OrgProfile{Auth: AUTH_PASSWORD}, ""), "Invalid org alias: a/b")
+	assert.EqualError(t, addOrg("dev", &OrgProfile{Auth: "saml"}, ""), "Unknown auth method: saml")
+}
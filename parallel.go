@@ -0,0 +1,193 @@
+package main
+
+import (
+	"fmt"
+	"strings"
+	"sync"
+)
+
+type installTask struct {
+	uri       string
+	installer *SalesforceInstaller
+	deps      []string
+	err       error
+	done      chan struct{}
+}
+
+// ParallelInstaller installs packages and their dependencies concurrently.
+// Downloads run as soon as a job is free. A package is deployed after all of its
+// dependencies (packages listed in its package.yml) are deployed.
+type ParallelInstaller struct {
+	logger  Logger
+	config  *config
+	report  *CommandReport
+	jobs    chan struct{}
+	mu      sync.Mutex
+	wg      sync.WaitGroup
+	tasks   map[string]*installTask
+	ordered []*installTask
+	// roots are the packages given to Install. Only they are deployed by delta with --since or --diff
+	roots map[string]bool
+	// artifact collects the zips of the packages instead of deploying them with spm pack
+	artifact *Artifact
+	// newDownloader is replaced in tests
+	newDownloader func(logger Logger, uri string) (Downloader, error)
+}
+
+func NewParallelInstaller(logger Logger, config *config, report *CommandReport, jobs int) *ParallelInstaller {
+	if jobs < 1 {
+		jobs = 1
+	}
+	return &ParallelInstaller{
+		logger:        logger,
+		config:        config,
+		report:        report,
+		jobs:          make(chan struct{}, jobs),
+		tasks:         map[string]*installTask{},
+		roots:         map[string]bool{},
+		newDownloader: dispatchDownloader,
+	}
+}
+
+// Install installs the packages and returns the first error in the order the packages are found.
+func (p *ParallelInstaller) Install(uris []string) error {
+	for _, uri := range uris {
+		p.roots[uri] = true
+	}
+	for _, uri := range uris {
+		p.task(uri)
+	}
+	p.wg.Wait()
+	p.logSummary()
+	for _, t := range p.ordered {
+		if t.err != nil {
+			return t.err
+		}
+	}
+	return nil
+}
+
+// task returns the task of the package, starting it on the first call.
+func (p *ParallelInstaller) task(uri string) *installTask {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	if t, ok := p.tasks[uri]; ok {
+		return t
+	}
+	t := &installTask{uri: uri, done: make(chan struct{})}
+	p.tasks[uri] = t
+	p.ordered = append(p.ordered, t)
+	p.wg.Add(1)
+	go p.run(t)
+	return t
+}
+
+func (p *ParallelInstaller) run(t *installTask) {
+	defer p.wg.Done()
+	defer close(t.done)
+	t.err = p.install(t)
+	if t.installer != nil {
+		t.installer.finish(t.err)
+	} else if t.err != nil {
+		result := NewPackageResult(t.uri)
+		result.Finish(t.err)
+		p.report.Add(result)
+	}
+}
+
+func (p *ParallelInstaller) install(t *installTask) error {
+	files, err := p.download(t)
+	if err != nil {
+		return err
+	}
+	for _, uri := range t.deps {
+		dep := p.task(uri)
+		<-dep.done
+		if dep.err != nil {
+			return &DependencyError{uri: t.uri, dependency: uri, err: dep.err}
+		}
+	}
+	p.jobs <- struct{}{}
+	defer func() { <-p.jobs }()
+	return t.installer.deploy(files)
+}
+
+func (p *ParallelInstaller) download(t *installTask) ([]*File, error) {
+	p.jobs <- struct{}{}
+	defer func() { <-p.jobs }()
+	// messages of the downloader and the org client are traced to the package by the field, since jobs interleave them
+	logger := p.logger.WithField("package", registryURI(t.uri))
+	downloader, err := p.newDownloader(logger, t.uri)
+	if err != nil {
+		return nil, err
+	}
+	installer, err := NewSalesforceInstaller(logger, downloader, p.config, t.uri)
+	if err != nil {
+		return nil, err
+	}
+	installer.report = p.report
+	installer.result = NewPackageResult(t.uri)
+	installer.artifact = p.artifact
+	t.installer = installer
+	files, err := installer.download()
+	if err != nil {
+		return nil, err
+	}
+	if p.roots[t.uri] {
+		files, err = installer.delta(files)
+		if err != nil {
+			return nil, err
+		}
+	}
+	deps, err := installer.dependencies(files)
+	if err != nil {
+		return nil, err
+	}
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	for _, uri := range deps {
+		if path := p.cycle(uri, t.uri); path != nil {
+			return nil, fmt.Errorf("Circular dependency: %s", strings.Join(append([]string{t.uri}, path...), " -> "))
+		}
+	}
+	t.deps = deps
+	return files, nil
+}
+
+// cycle returns the dependency path from uri to target if exists. p.mu must be held.
+func (p *ParallelInstaller) cycle(uri string, target string) []string {
+	if uri == target {
+		return []string{uri}
+	}
+	t, ok := p.tasks[uri]
+	if !ok {
+		return nil
+	}
+	for _, dep := range t.deps {
+		if path := p.cycle(dep, target); path != nil {
+			return append([]string{uri}, path...)
+		}
+	}
+	return nil
+}
+
+func (p *ParallelInstaller) logSummary() {
+	succeeded := 0
+	for _, t := range p.ordered {
+		if t.err == nil {
+			succeeded++
+		}
+	}
+	p.logger.Infof("Summary: %d succeeded, %d failed", succeeded, len(p.ordered)-succeeded)
+	for _, t := range p.ordered {
+		duration := 0.0
+		if t.installer != nil && t.installer.result != nil {
+			duration = t.installer.result.Duration
+		}
+		if t.err != nil {
+			p.logger.Errorf("  %s: failed (%.1fs)", t.uri, duration)
+		} else {
+			p.logger.Infof("  %s: succeeded (%.1fs)", t.uri, duration)
+		}
+	}
+}
@@ -0,0 +1,113 @@
+package main
+
+import (
+	"bytes"
+	"io/ioutil"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func newParallelInstaller(endpoint string, packages map[string][]*File) *ParallelInstaller {
+	config := &config{
+		credentials: credentials{Username: "hoge@example.com", Password: "fuga"},
+		Endpoint:    endpoint,
+		ApiVersion:  "38.0",
+		Directory:   "/tmp",
+	}
+	p := NewParallelInstaller(NewSpmLogger(ioutil.Discard, ioutil.Discard), config, NewCommandReport("install"), 2)
+	p.newDownloader = func(logger Logger, uri string) (Downloader, error) {
+		return &stubDownloader{files: packages[uri]}, nil
+	}
+	return p
+}
+
+func packageFiles(member string, dependencies string) []*File {
+	files := []*File{
+		{Name: "unpackaged/package.xml", Body: newPackageXML([]*component{{Type: "ApexClass", Member: member}}, "38.0").Bytes()},
+		{Name: "unpackaged/classes/" + member + ".cls", Body: []byte("public class " + member + " {}")},
+		{Name: "unpackaged/classes/" + member + ".cls-meta.xml", Body: []byte("<ApexClass/>")},
+	}
+	if dependencies != "" {
+		files = append(files, &File{Name: "unpackaged/package.yml", Body: []byte(dependencies)})
+	}
+	return files
+}
+
+func TestParallelInstall(t *testing.T) {
+	server := httptest.NewServer(NewMockServer(NewSpmLogger(ioutil.Discard, ioutil.Discard), nil))
+	defer server.Close()
+
+	p := newParallelInstaller(server.URL, map[string][]*File{
+		"https://github.com/tzmfreedom/a": packageFiles("A", "packages:\n  - tzmfreedom/c\n"),
+		"https://github.com/tzmfreedom/b": packageFiles("B", "packages:\n  - tzmfreedom/c\n"),
+		"https://github.com/tzmfreedom/c": packageFiles("C", ""),
+	})
+	err := p.Install([]string{"https://github.com/tzmfreedom/a", "https://github.com/tzmfreedom/b"})
+	assert.Nil(t, err)
+	assert.Equal(t, 3, len(p.report.Packages))
+	assert.Equal(t, "https://github.com/tzmfreedom/c", p.report.Packages[0].URI)
+	for _, result := range p.report.Packages {
+		assert.Equal(t, "Succeeded", result.Status)
+	}
+}
+
+func TestParallelInstallCircularDependency(t *testing.T) {
+	server := httptest.NewServer(NewMockServer(NewSpmLogger(ioutil.Discard, ioutil.Discard), nil))
+	defer server.Close()
+
+	p := newParallelInstaller(server.URL, map[string][]*File{
+		"https://github.com/tzmfreedom/a": packageFiles("A", "packages:\n  - tzmfreedom/b\n"),
+		"https://github.com/tzmfreedom/b": packageFiles("B", "packages:\n  - tzmfreedom/a\n"),
+	})
+	err := p.Install([]string{"https://github.com/tzmfreedom/a"})
+	assert.EqualError(t, err, "https://github.com/tzmfreedom/a: Dependency https://github.com/tzmfreedom/b is not installed")
+	assert.EqualError(t, p.tasks["https://github.com/tzmfreedom/b"].err, "Circular dependency: https://github.com/tzmfreedom/b -> https://github.com/tzmfreedom/a -> https://github.com/tzmfreedom/b")
+}
+
+func TestParallelInstallDependencyExitCode(t *testing.T) {
+	server := httptest.NewServer(NewMockServer(NewSpmLogger(ioutil.Discard, ioutil.Discard), &MockScenario{
+		TestFailures: []*MockTestFailure{{Class: "CTest", Method: "testC", Message: "System.AssertException: Assertion Failed"}},
+	}))
+	defer server.Close()
+
+	p := newParallelInstaller(server.URL, map[string][]*File{
+		"https://github.com/tzmfreedom/a": packageFiles("A", "packages:\n  - tzmfreedom/c\n"),
+		"https://github.com/tzmfreedom/c": packageFiles("C", ""),
+	})
+	err := p.Install([]string{"https://github.com/tzmfreedom/a"})
+	assert.EqualError(t, err, "https://github.com/tzmfreedom/a: Dependency https://github.com/tzmfreedom/c is not installed")
+	assert.Equal(t, ExitCodeTestFailure, exitCode(err))
+	p.report.Finish(err)
+	assert.Equal(t, ExitCodeTestFailure, p.report.ExitCode)
+}
+
+func TestParallelInstallLogsPackage(t *testing.T) {
+	server := httptest.NewServer(NewMockServer(NewSpmLogger(ioutil.Discard, ioutil.Discard), nil))
+	defer server.Close()
+	packages := map[string][]*File{
+		"https://github.com/tzmfreedom/a": packageFiles("A", ""),
+		"https://github.com/tzmfreedom/b": packageFiles("B", ""),
+	}
+	outStream := new(bytes.Buffer)
+	logger := NewSpmLogger(outStream, outStream)
+	assert.Nil(t, logger.SetFormat("json"))
+	p := newParallelInstaller(server.URL, packages)
+	p.logger = logger
+	p.newDownloader = func(logger Logger, uri string) (Downloader, error) {
+		logger.Info("Clone repository")
+		return &stubDownloader{files: packages[uri]}, nil
+	}
+	assert.Nil(t, p.Install([]string{"https://github.com/tzmfreedom/a", "https://github.com/tzmfreedom/b"}))
+
+	clones := 0
+	for _, line := range strings.Split(outStream.String(), "\n") {
+		if strings.Contains(line, "Clone repository") {
+			clones++
+			assert.Regexp(t, `"package":"https://github.com/tzmfreedom/[ab]"`, line)
+		}
+	}
+	assert.Equal(t, 2, clones)
+}
@@ -0,0 +1,102 @@
+package main
+
+import (
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+)
+
+// DeployPlan is the deployment of a package shown by --dry-run instead of deploying.
+// Components are listed by type, as package.xml and the destructive changes manifest of the zip.
+type DeployPlan struct {
+	CheckOnly           bool                `json:"check_only"`
+	PurgeOnDelete       bool                `json:"purge_on_delete"`
+	Deploy              map[string][]string `json:"deploy"`
+	Delete              map[string][]string `json:"delete,omitempty"`
+	DestructiveManifest string              `json:"destructive_manifest,omitempty"`
+	Zip                 string              `json:"zip,omitempty"`
+}
+
+func newDeployPlan(zip []byte, options *DeployOptions) (*DeployPlan, error) {
+	files, err := unzipFiles(zip)
+	if err != nil {
+		return nil, err
+	}
+	p := &DeployPlan{Deploy: map[string][]string{}}
+	if options != nil {
+		p.CheckOnly = options.CheckOnly
+		p.PurgeOnDelete = options.PurgeOnDelete
+	}
+	for _, f := range files {
+		_, name := splitPackageRoot(f.Name)
+		switch name {
+		case "package.xml", "destructiveChanges.xml", "destructiveChangesPre.xml", "destructiveChangesPost.xml":
+		default:
+			continue
+		}
+		manifest, err := parsePackageXML(f.Body)
+		if err != nil {
+			return nil, err
+		}
+		members := map[string][]string{}
+		for _, t := range manifest.Types {
+			members[t.Name] = append(members[t.Name], t.Members...)
+		}
+		if name == "package.xml" {
+			p.Deploy = members
+			continue
+		}
+		p.Delete = members
+		p.DestructiveManifest = name
+	}
+	return p, nil
+}
+
+// plan shows the components the zip would deploy and delete with the deploy options,
+// and saves the zip to the directory of --out.
+func (i *SalesforceInstaller) plan(zip []byte, options *DeployOptions) error {
+	p, err := newDeployPlan(zip, options)
+	if err != nil {
+		return err
+	}
+	if i.config.Out != "" {
+		p.Zip = filepath.Join(i.config.Out, strings.TrimPrefix(registryName(i.uri), REGISTRY_PREFIX)+".zip")
+		if err := os.MkdirAll(i.config.Out, 0755); err != nil {
+			return err
+		}
+		if err := ioutil.WriteFile(p.Zip, zip, 0644); err != nil {
+			return err
+		}
+	}
+	i.result.Plan = p
+
+	commit := ""
+	if i.result.Commit != "" {
+		commit = fmt.Sprintf(" (commit: %s)", i.result.Commit)
+	}
+	i.logger.Infof("%s: Plan%s", i.uri, commit)
+	i.logger.Infof("  options: checkOnly=%t purgeOnDelete=%t", p.CheckOnly, p.PurgeOnDelete)
+	for _, t := range sortedKeys(p.Deploy) {
+		i.logger.Infof("  deploy %s: %s", t, strings.Join(p.Deploy[t], ", "))
+	}
+	for _, t := range sortedKeys(p.Delete) {
+		i.logger.Infof("  delete %s: %s (%s)", t, strings.Join(p.Delete[t], ", "), p.DestructiveManifest)
+	}
+	if p.Zip != "" {
+		i.logger.Infof("  zip: %s", p.Zip)
+	}
+	i.logger.Infof("%s: Nothing is deployed (dry run)", i.uri)
+	return nil
+}
+
+func sortedKeys(m map[string][]string) []string {
+	keys := make([]string, 0, len(m))
+	for key := range m {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+	return keys
+}
@@ -0,0 +1,40 @@
+package main
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestDryRun(t *testing.T) {
+	dir, err := ioutil.TempDir("", "spm")
+	assert.Nil(t, err)
+	defer os.RemoveAll(dir)
+
+	// the endpoint is never connected by dry runs
+	config := &config{Endpoint: "http://127.0.0.1:1", ApiVersion: "38.0", DryRun: true, Out: dir}
+	installer, err := NewSalesforceInstaller(NewSpmLogger(ioutil.Discard, ioutil.Discard), &stubDownloader{files: mockPackageFiles}, config, "https://github.com/tzmfreedom/hoge")
+	assert.Nil(t, err)
+	assert.Nil(t, installer.Install())
+
+	plan := installer.result.Plan
+	assert.Equal(t, map[string][]string{"ApexClass": {"Hoge"}, "StaticResource": {registryName(installer.uri)}}, plan.Deploy)
+	assert.Nil(t, plan.Delete)
+	assert.False(t, plan.CheckOnly)
+	assert.Equal(t, filepath.Join(dir, strings.TrimPrefix(registryName(installer.uri), REGISTRY_PREFIX)+".zip"), plan.Zip)
+
+	buf, err := ioutil.ReadFile(plan.Zip)
+	assert.Nil(t, err)
+	files, err := unzipFiles(buf)
+	assert.Nil(t, err)
+	names := []string{}
+	for _, f := range files {
+		names = append(names, f.Name)
+	}
+	assert.Contains(t, names, "unpackaged/classes/Hoge.cls")
+	assert.Contains(t, names, "unpackaged/staticresources/"+registryName(installer.uri)+".resource")
+}
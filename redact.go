@@ -0,0 +1,84 @@
+package main
+
+import (
+	"regexp"
+	"sort"
+	"strings"
+	"sync"
+
+	"github.com/Sirupsen/logrus"
+)
+
+const REDACTED = "****"
+
+// redactPatterns mask secrets by their shape. The first and second groups of each pattern are kept.
+var redactPatterns = []*regexp.Regexp{
+	// password in URI (i.g. sf://user:password@login.salesforce.com)
+	regexp.MustCompile(`([a-zA-Z][a-zA-Z0-9+.-]*://[^:/@\s]*:)[^@/\s]+(@)`),
+	// salesforce session ID and access token
+	regexp.MustCompile(`(00D[a-zA-Z0-9]{12,15}!)[a-zA-Z0-9._]+`),
+	regexp.MustCompile(`(?i)(Authorization:\s*(?:Bearer|OAuth|Basic)?\s*)[^\s"]+`),
+	regexp.MustCompile(`(<(?:[a-zA-Z]+:)?(?:sessionId|password)>)[^<]*`),
+	regexp.MustCompile(`("(?:access_token|refresh_token|client_secret|password|sessionId)"\s*:\s*")[^"]*`),
+	regexp.MustCompile(`((?:access_token|refresh_token|client_secret|password|assertion)=)[^&\s"]+`),
+}
+
+// Redactor masks secrets in every output of spm. Secrets known at runtime
+// (passwords, tokens, session IDs) are registered by Add, in addition to redactPatterns.
+type Redactor struct {
+	mu      sync.RWMutex
+	secrets []string
+}
+
+var redactor = &Redactor{}
+
+func (r *Redactor) Add(secret string) {
+	if len(secret) < 4 {
+		return
+	}
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	for _, s := range r.secrets {
+		if s == secret {
+			return
+		}
+	}
+	r.secrets = append(r.secrets, secret)
+	// replace longer secrets first, so that a secret containing another one is fully masked
+	sort.Slice(r.secrets, func(i, j int) bool {
+		return len(r.secrets[i]) > len(r.secrets[j])
+	})
+}
+
+func (r *Redactor) Redact(s string) string {
+	r.mu.RLock()
+	for _, secret := range r.secrets {
+		s = strings.Replace(s, secret, REDACTED, -1)
+	}
+	r.mu.RUnlock()
+	for _, pattern := range redactPatterns {
+		s = pattern.ReplaceAllString(s, "${1}"+REDACTED+"${2}")
+	}
+	return s
+}
+
+func redact(s string) string {
+	return redactor.Redact(s)
+}
+
+// redactHook masks secrets in the message and fields of every log entry.
+type redactHook struct{}
+
+func (h *redactHook) Levels() []logrus.Level {
+	return logrus.AllLevels
+}
+
+func (h *redactHook) Fire(entry *logrus.Entry) error {
+	entry.Message = redact(entry.Message)
+	for k, v := range entry.Data {
+		if s, ok := v.(string); ok {
+			entry.Data[k] = redact(s)
+		}
+	}
+	return nil
+}
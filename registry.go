@@ -0,0 +1,337 @@
+package main
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"regexp"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// REGISTRY_PREFIX prefixes the names of the static resources recording installed packages.
+const REGISTRY_PREFIX = "spm_"
+
+var (
+	registryNameRegexp = regexp.MustCompile(`[^a-zA-Z0-9]+`)
+	uriPasswordRegexp  = regexp.MustCompile(`^([a-zA-Z][a-zA-Z0-9+.-]*://[^:/@]*:)[^@/]+(@)`)
+)
+
+// PackageRecord is the registry record of a package installed by spm.
+// It is deployed as a static resource named after the package, together with the package.
+type PackageRecord struct {
+	URI          string    `json:"uri"`
+	Ref          string    `json:"ref,omitempty"`
+	Commit       string    `json:"commit,omitempty"`
+	Dependencies []string  `json:"dependencies,omitempty"`
+	SpmVersion   string    `json:"spm_version,omitempty"`
+	InstalledAt  time.Time `json:"installed_at"`
+}
+
+func NewPackageRecord(uri string, dependencies []string) *PackageRecord {
+	p := &PackageRecord{
+		URI:          registryURI(uri),
+		Dependencies: []string{},
+		SpmVersion:   Version,
+		InstalledAt:  time.Now(),
+	}
+	if _, _, _, branch, err := extractInstallParameter(uri); err == nil {
+		p.Ref = branch
+	}
+	for _, dep := range dependencies {
+		p.Dependencies = append(p.Dependencies, registryURI(dep))
+	}
+	return p
+}
+
+// registryURI masks the password of the URI (i.g. sf://user:password@login.salesforce.com),
+// so that the same package is recorded by the same URI without secrets.
+func registryURI(uri string) string {
+	return uriPasswordRegexp.ReplaceAllString(uri, "${1}"+REDACTED+"${2}")
+}
+
+// registryName returns the name of the static resource of the package, i.g. spm_github_com_tzmfreedom_hoge_1a2b3c4d.
+// The name is made of letters, digits and single underscores as salesforce requires.
+func registryName(uri string) string {
+	uri = registryURI(uri)
+	sum := sha256.Sum256([]byte(uri))
+	name := uri
+	if i := strings.Index(name, "://"); i >= 0 {
+		name = name[i+3:]
+	}
+	name = strings.Trim(registryNameRegexp.ReplaceAllString(name, "_"), "_")
+	if len(name) > 60 {
+		name = strings.TrimLeft(name[len(name)-60:], "_")
+	}
+	return REGISTRY_PREFIX + name + "_" + hex.EncodeToString(sum[:4])
+}
+
+func (p *PackageRecord) Component() *component {
+	return &component{Type: "StaticResource", Member: registryName(p.URI)}
+}
+
+// Files returns the static resource and its meta file of the record.
+func (p *PackageRecord) Files(root string) ([]*File, error) {
+	body, err := json.MarshalIndent(p, "", "  ")
+	if err != nil {
+		return nil, err
+	}
+	name := registryName(p.URI)
+	meta := fmt.Sprintf(`<?xml version="1.0" encoding="UTF-8"?>
+<StaticResource xmlns="%s">
+    <cacheControl>Private</cacheControl>
+    <contentType>application/json</contentType>
+    <description>Installed by spm: %s</description>
+</StaticResource>
+`, METADATA_NAMESPACE, p.URI)
+	return []*File{
+		{Name: root + "/staticresources/" + name + ".resource", Body: body},
+		{Name: root + "/staticresources/" + name + ".resource-meta.xml", Body: []byte(meta)},
+	}, nil
+}
+
+// addRegistryRecord adds the static resource of the record to the files and package.xml of the package.
+func addRegistryRecord(files []*File, record *PackageRecord) ([]*File, error) {
+	var err error
+	if isZipped(files) {
+		files, err = unzipFiles(files[0].Body)
+		if err != nil {
+			return nil, err
+		}
+	}
+	for i, f := range files {
+		root, name := splitPackageRoot(f.Name)
+		if name != "package.xml" {
+			continue
+		}
+		p, err := parsePackageXML(f.Body)
+		if err != nil {
+			return nil, err
+		}
+		manifest := newPackageXML(append(p.Components(), record.Component()), p.Version)
+		recordFiles, err := record.Files(root)
+		if err != nil {
+			return nil, err
+		}
+		added := append([]*File{}, files[:i]...)
+		added = append(added, &File{Name: f.Name, Body: manifest.Bytes()})
+		added = append(added, files[i+1:]...)
+		return append(added, recordFiles...), nil
+	}
+	return nil, errors.New("Package.xml Not Found")
+}
+
+// touchRegistryRecord sets the installation time of the record in the zip of the package to now.
+// The zips of artifacts are built by spm pack before they are deployed. Zips without the record are returned as they are.
+func touchRegistryRecord(zip []byte, uri string) ([]byte, error) {
+	files, err := unzipFiles(zip)
+	if err != nil {
+		return nil, err
+	}
+	name := "staticresources/" + registryName(uri) + ".resource"
+	found := false
+	for _, f := range files {
+		if _, n := splitPackageRoot(f.Name); n != name {
+			continue
+		}
+		record := &PackageRecord{}
+		if err := json.Unmarshal(f.Body, record); err != nil {
+			return nil, err
+		}
+		record.InstalledAt = time.Now()
+		f.Body, err = json.MarshalIndent(record, "", "  ")
+		if err != nil {
+			return nil, err
+		}
+		found = true
+	}
+	if !found {
+		return zip, nil
+	}
+	zipped, err := NewZipConverter().Convert(files)
+	if err != nil {
+		return nil, err
+	}
+	return zipped[0].Body, nil
+}
+
+// Registry is the packages installed in an org, keyed by URI.
+type Registry struct {
+	Packages map[string]*PackageRecord
+}
+
+func NewRegistry() *Registry {
+	return &Registry{Packages: map[string]*PackageRecord{}}
+}
+
+// readRegistry retrieves the records of installed packages from the org.
+func readRegistry(client *ForceClient) (*Registry, error) {
+	r := NewRegistry()
+	list, err := client.ListMetadata([]*ListMetadataQuery{{Type_: "StaticResource"}})
+	if err != nil {
+		return nil, err
+	}
+	names := []string{}
+	for _, p := range list.Result {
+		if strings.HasPrefix(p.FullName, REGISTRY_PREFIX) {
+			names = append(names, p.FullName)
+		}
+	}
+	if len(names) == 0 {
+		return r, nil
+	}
+	version, err := strconv.ParseFloat(client.apiVersion, 64)
+	if err != nil {
+		return nil, err
+	}
+	request, err := createRetrieveRequest(&MetaPackageFile{
+		Version: version,
+		Types:   []*Type{{Name: "StaticResource", Members: names}},
+	})
+	if err != nil {
+		return nil, err
+	}
+	files, err := client.RetrieveFiles(request)
+	if err != nil {
+		return nil, err
+	}
+	for _, f := range files {
+		if !strings.HasSuffix(f.Name, ".resource") {
+			continue
+		}
+		p := &PackageRecord{}
+		if err := json.Unmarshal(f.Body, p); err != nil {
+			// static resources of other tools may have the prefix
+			continue
+		}
+		if p.URI != "" {
+			r.Add(p)
+		}
+	}
+	return r, nil
+}
+
+func (r *Registry) Add(p *PackageRecord) {
+	r.Packages[p.URI] = p
+}
+
+// Get returns the record of the package, or nil if not installed by spm.
+func (r *Registry) Get(uri string) *PackageRecord {
+	return r.Packages[registryURI(uri)]
+}
+
+// Find returns the record of the package installed from the same repository at any ref,
+// preferring the exact URI, then the latest installed.
+func (r *Registry) Find(uri string) *PackageRecord {
+	if p := r.Get(uri); p != nil {
+		return p
+	}
+	var found *PackageRecord
+	repository := withoutRef(registryURI(uri))
+	for _, p := range r.Packages {
+		if withoutRef(p.URI) != repository {
+			continue
+		}
+		if found == nil || p.InstalledAt.After(found.InstalledAt) {
+			found = p
+		}
+	}
+	return found
+}
+
+// withoutRef removes the ref of the URI, i.g. https://github.com/tzmfreedom/hoge@develop
+func withoutRef(uri string) string {
+	if i := strings.LastIndex(uri, "@"); i > strings.LastIndex(uri, "/") {
+		return uri[:i]
+	}
+	return uri
+}
+
+// List returns the records sorted by URI.
+func (r *Registry) List() []*PackageRecord {
+	uris := make([]string, 0, len(r.Packages))
+	for uri := range r.Packages {
+		uris = append(uris, uri)
+	}
+	sort.Strings(uris)
+	list := []*PackageRecord{}
+	for _, uri := range uris {
+		list = append(list, r.Packages[uri])
+	}
+	return list
+}
+
+// Dependents returns the installed packages depending on the package directly.
+func (r *Registry) Dependents(uri string) []string {
+	uri = registryURI(uri)
+	dependents := []string{}
+	for _, p := range r.Packages {
+		if containsString(p.Dependencies, uri) {
+			dependents = append(dependents, p.URI)
+		}
+	}
+	sort.Strings(dependents)
+	return dependents
+}
+
+// UninstallOrder returns the packages to uninstall in reverse topological order, dependents first.
+// If other installed packages depend on them, they are uninstalled together with cascade, or an error is returned.
+func (r *Registry) UninstallOrder(uris []string, cascade bool) ([]string, error) {
+	targets := map[string]string{}
+	for _, uri := range uris {
+		targets[registryURI(uri)] = uri
+	}
+	queue := append([]string{}, uris...)
+	for len(queue) > 0 {
+		uri := queue[0]
+		queue = queue[1:]
+		required := []string{}
+		for _, dependent := range r.Dependents(uri) {
+			if _, ok := targets[dependent]; ok {
+				continue
+			}
+			if !cascade {
+				required = append(required, dependent)
+				continue
+			}
+			// the recorded URI can not be downloaded without the password masked by registryURI
+			if uriPasswordRegexp.MatchString(dependent) {
+				return nil, fmt.Errorf("%s is required by %s, whose password is not recorded. Add it with the password to the packages to uninstall them together", registryURI(uri), dependent)
+			}
+			targets[dependent] = dependent
+			queue = append(queue, dependent)
+		}
+		if len(required) > 0 {
+			return nil, fmt.Errorf("%s is required by %s. Use --cascade to uninstall them together", registryURI(uri), strings.Join(required, ", "))
+		}
+	}
+
+	keys := make([]string, 0, len(targets))
+	for key := range targets {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+	ordered := []string{}
+	visited := map[string]bool{}
+	var visit func(key string)
+	visit = func(key string) {
+		if visited[key] {
+			return
+		}
+		visited[key] = true
+		for _, dependent := range r.Dependents(key) {
+			if _, ok := targets[dependent]; ok {
+				visit(dependent)
+			}
+		}
+		ordered = append(ordered, targets[key])
+	}
+	for _, key := range keys {
+		visit(key)
+	}
+	return ordered, nil
+}
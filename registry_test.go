@@ -0,0 +1,66 @@
+package main
+
+import (
+	"io/ioutil"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestRegistryName(t *testing.T) {
+	assert.Equal(t, "spm_github_com_tzmfreedom_hoge_", registryName("https://github.com/tzmfreedom/hoge")[:31])
+	assert.Equal(t, registryName("sf://hoge:fuga@login.salesforce.com?path=./package.toml"), registryName("sf://hoge:piyo@login.salesforce.com?path=./package.toml"))
+	assert.NotEqual(t, registryName("https://github.com/tzmfreedom/hoge"), registryName("https://github.com/tzmfreedom/hoge@develop"))
+	assert.Equal(t, "sf://hoge:****@login.salesforce.com?path=./package.toml", registryURI("sf://hoge:fuga@login.salesforce.com?path=./package.toml"))
+}
+
+func TestRegistryUninstallOrder(t *testing.T) {
+	r := NewRegistry()
+	r.Add(NewPackageRecord("https://github.com/tzmfreedom/util", nil))
+	r.Add(NewPackageRecord("https://github.com/tzmfreedom/app1", []string{"https://github.com/tzmfreedom/util"}))
+	r.Add(NewPackageRecord("https://github.com/tzmfreedom/app2", []string{"https://github.com/tzmfreedom/app1", "https://github.com/tzmfreedom/util"}))
+	assert.Equal(t, []string{"https://github.com/tzmfreedom/app1", "https://github.com/tzmfreedom/app2"}, r.Dependents("https://github.com/tzmfreedom/util"))
+
+	_, err := r.UninstallOrder([]string{"https://github.com/tzmfreedom/util"}, false)
+	assert.EqualError(t, err, "https://github.com/tzmfreedom/util is required by https://github.com/tzmfreedom/app1, https://github.com/tzmfreedom/app2. Use --cascade to uninstall them together")
+
+	ordered, err := r.UninstallOrder([]string{"https://github.com/tzmfreedom/util"}, true)
+	assert.Nil(t, err)
+	assert.Equal(t, []string{"https://github.com/tzmfreedom/app2", "https://github.com/tzmfreedom/app1", "https://github.com/tzmfreedom/util"}, ordered)
+
+	ordered, err = r.UninstallOrder([]string{"https://github.com/tzmfreedom/app2"}, false)
+	assert.Nil(t, err)
+	assert.Equal(t, []string{"https://github.com/tzmfreedom/app2"}, ordered)
+
+	// dependents of sf:// URIs are uninstalled by the URIs with the passwords given
+	r.Add(NewPackageRecord("sf://hoge:fuga@login.salesforce.com?path=./package.toml", []string{"https://github.com/tzmfreedom/app2"}))
+	_, err = r.UninstallOrder([]string{"https://github.com/tzmfreedom/app2"}, true)
+	assert.EqualError(t, err, "https://github.com/tzmfreedom/app2 is required by sf://hoge:****@login.salesforce.com?path=./package.toml, whose password is not recorded. Add it with the password to the packages to uninstall them together")
+	ordered, err = r.UninstallOrder([]string{"https://github.com/tzmfreedom/app2", "sf://hoge:fuga@login.salesforce.com?path=./package.toml"}, true)
+	assert.Nil(t, err)
+	assert.Equal(t, []string{"sf://hoge:fuga@login.salesforce.com?path=./package.toml", "https://github.com/tzmfreedom/app2"}, ordered)
+}
+
+func TestReadRegistry(t *testing.T) {
+	server := httptest.NewServer(NewMockServer(NewSpmLogger(ioutil.Discard, ioutil.Discard), nil))
+	defer server.Close()
+
+	installer := newMockInstaller(t, server.URL, mockPackageFiles)
+	installer.result = NewPackageResult(installer.uri)
+	installer.result.Commit = "0123456789abcdef"
+	assert.Nil(t, installer.deploy(mockPackageFiles))
+
+	registry, err := readRegistry(installer.client)
+	assert.Nil(t, err)
+	record := registry.Get("https://github.com/tzmfreedom/hoge")
+	assert.NotNil(t, record)
+	assert.Equal(t, "master", record.Ref)
+	assert.Equal(t, "0123456789abcdef", record.Commit)
+
+	installer.registry = registry
+	assert.Nil(t, installer.Uninstall())
+	registry, err = readRegistry(installer.client)
+	assert.Nil(t, err)
+	assert.Equal(t, 0, len(registry.List()))
+}
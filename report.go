@@ -0,0 +1,155 @@
+package main
+
+import (
+	"encoding/json"
+	"io"
+	"sync"
+	"time"
+)
+
+// CommandReport is the result of a command printed by --json.
+type CommandReport struct {
+	Command    string           `json:"command"`
+	Success    bool             `json:"success"`
+	Error      string           `json:"error,omitempty"`
+	ExitCode   int              `json:"exit_code"`
+	Packages   []*PackageResult `json:"packages"`
+	Installed  []*PackageRecord `json:"installed,omitempty"`
+	Comparison *Comparison      `json:"comparison,omitempty"`
+	StartedAt  time.Time        `json:"started_at"`
+	FinishedAt time.Time        `json:"finished_at"`
+	Duration   float64          `json:"duration_seconds"`
+	mu         sync.Mutex
+}
+
+type PackageResult struct {
+	URI                string             `json:"uri"`
+	Commit             string             `json:"commit,omitempty"`
+	DeployId           string             `json:"deploy_id,omitempty"`
+	Status             string             `json:"status,omitempty"`
+	Directory          string             `json:"directory,omitempty"`
+	ComponentSuccesses []*ComponentResult `json:"component_successes,omitempty"`
+	ComponentFailures  []*ComponentResult `json:"component_failures,omitempty"`
+	Tests              *TestResult        `json:"tests,omitempty"`
+	Diffs              []*ComponentDiff   `json:"diffs,omitempty"`
+	Plan               *DeployPlan        `json:"plan,omitempty"`
+	Error              string             `json:"error,omitempty"`
+	StartedAt          time.Time          `json:"started_at"`
+	Duration           float64            `json:"duration_seconds"`
+}
+
+type ComponentResult struct {
+	Type     string `json:"type"`
+	FullName string `json:"full_name"`
+	FileName string `json:"file_name,omitempty"`
+	Problem  string `json:"problem,omitempty"`
+	Line     int32  `json:"line,omitempty"`
+	Column   int32  `json:"column,omitempty"`
+}
+
+type TestResult struct {
+	NumTestsRun int32                `json:"num_tests_run"`
+	NumFailures int32                `json:"num_failures"`
+	TotalTime   float64              `json:"total_time"`
+	Failures    []*TestFailureResult `json:"failures,omitempty"`
+}
+
+type TestFailureResult struct {
+	Name       string  `json:"name"`
+	MethodName string  `json:"method_name"`
+	Message    string  `json:"message"`
+	StackTrace string  `json:"stack_trace,omitempty"`
+	Time       float64 `json:"time"`
+}
+
+func NewCommandReport(command string) *CommandReport {
+	return &CommandReport{
+		Command:   command,
+		Packages:  []*PackageResult{},
+		StartedAt: time.Now(),
+	}
+}
+
+func NewPackageResult(uri string) *PackageResult {
+	return &PackageResult{
+		URI:       redact(uri),
+		StartedAt: time.Now(),
+	}
+}
+
+// Add appends the result of a package. It is safe for concurrent use.
+func (r *CommandReport) Add(result *PackageResult) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.Packages = append(r.Packages, result)
+}
+
+// Finish records the error of the command and the timings.
+func (r *CommandReport) Finish(err error) {
+	r.FinishedAt = time.Now()
+	r.Duration = r.FinishedAt.Sub(r.StartedAt).Seconds()
+	r.Success = err == nil
+	r.ExitCode = exitCode(err)
+	if err != nil {
+		r.Error = redact(err.Error())
+	}
+}
+
+func (r *CommandReport) Write(w io.Writer) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	encoder := json.NewEncoder(w)
+	encoder.SetIndent("", "  ")
+	return encoder.Encode(r)
+}
+
+// Finish records the error of the package and the duration.
+func (p *PackageResult) Finish(err error) {
+	p.Duration = time.Since(p.StartedAt).Seconds()
+	if err != nil {
+		p.Error = redact(err.Error())
+	}
+}
+
+// SetDeployResult records the components and the tests of the deployment.
+func (p *PackageResult) SetDeployResult(result *DeployResult) {
+	if result.Status != nil {
+		p.Status = string(*result.Status)
+	}
+	if result.Details == nil {
+		return
+	}
+	for _, m := range result.Details.ComponentSuccesses {
+		p.ComponentSuccesses = append(p.ComponentSuccesses, newComponentResult(m))
+	}
+	for _, m := range result.Details.ComponentFailures {
+		p.ComponentFailures = append(p.ComponentFailures, newComponentResult(m))
+	}
+	if tr := result.Details.RunTestResult; tr != nil {
+		p.Tests = &TestResult{
+			NumTestsRun: tr.NumTestsRun,
+			NumFailures: tr.NumFailures,
+			TotalTime:   tr.TotalTime,
+		}
+		for _, f := range tr.Failures {
+			p.Tests.Failures = append(p.Tests.Failures, &TestFailureResult{
+				Name:       f.Name,
+				MethodName: f.MethodName,
+				Message:    f.Message,
+				StackTrace: f.StackTrace,
+				Time:       f.Time,
+			})
+		}
+	}
+}
+
+func newComponentResult(m *DeployMessage) *ComponentResult {
+	return &ComponentResult{
+		Type:     m.ComponentType,
+		FullName: m.FullName,
+		FileName: m.FileName,
+		Problem:  m.Problem,
+		Line:     m.LineNumber,
+		Column:   m.ColumnNumber,
+	}
+}
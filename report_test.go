@@ -0,0 +1,55 @@
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestReportWrite(t *testing.T) {
+	report := NewCommandReport("install")
+	result := NewPackageResult("https://github.com/tzmfreedom/hoge")
+	status := DeployStatusFailed
+	result.SetDeployResult(&DeployResult{
+		Status: &status,
+		Details: &DeployDetails{
+			ComponentFailures: []*DeployMessage{
+				{ComponentType: "ApexClass", FullName: "Hoge", LineNumber: 3, ColumnNumber: 5, Problem: "unexpected token: }"},
+			},
+		},
+	})
+	err := newDeployResultError(result.URI, &DeployResult{})
+	result.Finish(err)
+	report.Add(result)
+	report.Finish(err)
+
+	buf := new(bytes.Buffer)
+	assert.Nil(t, report.Write(buf))
+	decoded := map[string]interface{}{}
+	assert.Nil(t, json.Unmarshal(buf.Bytes(), &decoded))
+	assert.Equal(t, "install", decoded["command"])
+	assert.Equal(t, false, decoded["success"])
+	assert.Equal(t, float64(ExitCodeDeployError), decoded["exit_code"])
+	pkg := decoded["packages"].([]interface{})[0].(map[string]interface{})
+	assert.Equal(t, "Failed", pkg["status"])
+	failure := pkg["component_failures"].([]interface{})[0].(map[string]interface{})
+	assert.Equal(t, "Hoge", failure["full_name"])
+	assert.Equal(t, float64(3), failure["line"])
+}
+
+func TestJsonOutput(t *testing.T) {
+	cli, _, _ := before()
+	outStream := new(bytes.Buffer)
+	cli.outStream = outStream
+	cli.errStream = new(bytes.Buffer)
+	cli.Run([]string{"spm", "--json", "status"})
+
+	report := &CommandReport{}
+	assert.Nil(t, json.Unmarshal(outStream.Bytes(), report))
+	assert.Equal(t, "status", report.Command)
+	assert.False(t, report.Success)
+	assert.Equal(t, "Deploy ID not specified", report.Error)
+	assert.Equal(t, ExitCodeError, report.ExitCode)
+}
@@ -0,0 +1,149 @@
+package main
+
+import (
+	"bufio"
+	"crypto/aes"
+	"crypto/cipher"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"golang.org/x/crypto/pbkdf2"
+	"golang.org/x/crypto/ssh/terminal"
+)
+
+const (
+	secretSaltSize   = 16
+	secretIterations = 100000
+)
+
+// SecretStore is a file of secrets encrypted with AES-GCM by a key derived from a passphrase.
+// The passphrase is read from SPM_PASSPHRASE, or prompted on the terminal.
+type SecretStore struct {
+	path       string
+	passphrase string
+}
+
+func NewSecretStore() *SecretStore {
+	return &SecretStore{path: filepath.Join(spmHomeDir(), "secrets")}
+}
+
+func (s *SecretStore) Exists() bool {
+	_, err := os.Stat(s.path)
+	return err == nil
+}
+
+func (s *SecretStore) Load() (map[string]string, error) {
+	secrets := map[string]string{}
+	buf, err := ioutil.ReadFile(s.path)
+	if os.IsNotExist(err) {
+		return secrets, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	if len(buf) < secretSaltSize {
+		return nil, errors.New("Secret store is broken")
+	}
+	passphrase, err := s.readPassphrase()
+	if err != nil {
+		return nil, err
+	}
+	gcm, err := newSecretCipher(passphrase, buf[:secretSaltSize])
+	if err != nil {
+		return nil, err
+	}
+	buf = buf[secretSaltSize:]
+	if len(buf) < gcm.NonceSize() {
+		return nil, errors.New("Secret store is broken")
+	}
+	plain, err := gcm.Open(nil, buf[:gcm.NonceSize()], buf[gcm.NonceSize():], nil)
+	if err != nil {
+		return nil, errors.New("Failed to unlock secret store. Passphrase may be incorrect")
+	}
+	if err = json.Unmarshal(plain, &secrets); err != nil {
+		return nil, err
+	}
+	return secrets, nil
+}
+
+func (s *SecretStore) Save(secrets map[string]string) error {
+	passphrase, err := s.readPassphrase()
+	if err != nil {
+		return err
+	}
+	plain, err := json.Marshal(secrets)
+	if err != nil {
+		return err
+	}
+	salt := make([]byte, secretSaltSize)
+	if _, err = io.ReadFull(rand.Reader, salt); err != nil {
+		return err
+	}
+	gcm, err := newSecretCipher(passphrase, salt)
+	if err != nil {
+		return err
+	}
+	nonce := make([]byte, gcm.NonceSize())
+	if _, err = io.ReadFull(rand.Reader, nonce); err != nil {
+		return err
+	}
+	buf := append(salt, nonce...)
+	buf = gcm.Seal(buf, nonce, plain, nil)
+	if err = os.MkdirAll(filepath.Dir(s.path), 0700); err != nil {
+		return err
+	}
+	return writeFileAtomic(s.path, buf, 0600)
+}
+
+func (s *SecretStore) readPassphrase() (string, error) {
+	if s.passphrase != "" {
+		return s.passphrase, nil
+	}
+	passphrase := os.Getenv("SPM_PASSPHRASE")
+	if passphrase == "" {
+		var err error
+		passphrase, err = promptSecret("Passphrase for secret store: ")
+		if err != nil {
+			return "", err
+		}
+	}
+	if passphrase == "" {
+		return "", errors.New("Passphrase is required")
+	}
+	s.passphrase = passphrase
+	return passphrase, nil
+}
+
+// promptSecret reads a secret from stdin. Input is not echoed when stdin is a terminal.
+func promptSecret(message string) (string, error) {
+	fmt.Fprint(os.Stderr, message)
+	if fd := int(os.Stdin.Fd()); terminal.IsTerminal(fd) {
+		secret, err := terminal.ReadPassword(fd)
+		fmt.Fprintln(os.Stderr)
+		if err != nil {
+			return "", err
+		}
+		return string(secret), nil
+	}
+	line, err := bufio.NewReader(os.Stdin).ReadString('\n')
+	if err != nil && err != io.EOF {
+		return "", err
+	}
+	return strings.TrimRight(line, "\r\n"), nil
+}
+
+func newSecretCipher(passphrase string, salt []byte) (cipher.AEAD, error) {
+	block, err := aes.NewCipher(pbkdf2.Key([]byte(passphrase), salt, secretIterations, 32, sha256.New))
+	if err != nil {
+		return nil, err
+	}
+	return cipher.NewGCM(block)
+}
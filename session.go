@@ -0,0 +1,200 @@
+package main
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"path/filepath"
+	"sync"
+	"time"
+)
+
+// sessions are shared by every ForceClient in the process, so that each org is logged in once per run.
+var sessions = NewSessionPool()
+
+// Session is a login session shared by the clients of the same org and user.
+type Session struct {
+	key         string
+	mu          sync.Mutex
+	loginResult *LoginResult
+	pool        *SessionPool
+}
+
+// SessionPool holds the sessions by org and user. Sessions are also cached on disk if cache is set.
+type SessionPool struct {
+	mu       sync.Mutex
+	sessions map[string]*Session
+	cache    *SessionCache
+}
+
+func NewSessionPool() *SessionPool {
+	return &SessionPool{sessions: map[string]*Session{}}
+}
+
+// Get returns the session of the key, creating an empty one on the first call.
+func (p *SessionPool) Get(key string) *Session {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	s, ok := p.sessions[key]
+	if !ok {
+		s = &Session{key: key, pool: p}
+		p.sessions[key] = s
+	}
+	return s
+}
+
+// Login sets the session to the client. authenticate is called only if the session is not established yet.
+func (s *Session) Login(client *ForceClient, authenticate func(*ForceClient) error) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if s.loginResult == nil && s.pool.cache != nil {
+		s.loginResult = s.pool.cache.Get(s.key)
+	}
+	if s.loginResult == nil {
+		if err := s.authenticate(client, authenticate); err != nil {
+			return err
+		}
+	}
+	client.loginResult = s.loginResult
+	client.session = s
+	client.authenticate = authenticate
+	return nil
+}
+
+// Renew authenticates again because expired is rejected by salesforce.
+// If another client has already renewed the session, the new one is used without login.
+func (s *Session) Renew(client *ForceClient, expired *LoginResult) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if s.loginResult == expired {
+		if err := s.authenticate(client, client.authenticate); err != nil {
+			return err
+		}
+	}
+	client.loginResult = s.loginResult
+	return nil
+}
+
+// authenticate logs in by the client and keeps the result. s.mu must be held.
+func (s *Session) authenticate(client *ForceClient, authenticate func(*ForceClient) error) error {
+	if err := authenticate(client); err != nil {
+		return &AuthenticationError{err}
+	}
+	redactor.Add(client.loginResult.SessionId)
+	s.loginResult = client.loginResult
+	if s.pool.cache != nil {
+		s.pool.cache.Put(s.key, s.loginResult)
+	}
+	return nil
+}
+
+// sessionKey identifies the org and user of the credentials. Secrets are hashed.
+func sessionKey(endpoint string, apiVersion string, c *credentials) string {
+	h := sha256.New()
+	for _, v := range []string{endpoint, apiVersion, c.Username, c.Password, c.TokenEndpoint, c.ClientId, c.RefreshToken, c.JwtKeyFile} {
+		h.Write([]byte(v))
+		h.Write([]byte{0})
+	}
+	return hex.EncodeToString(h.Sum(nil))
+}
+
+type cachedSession struct {
+	SessionId         string    `json:"session_id"`
+	ServerUrl         string    `json:"server_url"`
+	MetadataServerUrl string    `json:"metadata_server_url"`
+	ExpiresAt         time.Time `json:"expires_at"`
+}
+
+// SessionCache keeps sessions in ~/.spm/sessions encrypted by the passphrase of the secret store.
+// Cached sessions are used until ttl passes from login.
+type SessionCache struct {
+	mu    sync.Mutex
+	store *SecretStore
+	ttl   time.Duration
+	// logger reports failures of the cache, which never fail the command
+	logger Logger
+}
+
+func NewSessionCache(logger Logger, ttl time.Duration) *SessionCache {
+	return &SessionCache{
+		store:  &SecretStore{path: filepath.Join(spmHomeDir(), "sessions")},
+		ttl:    ttl,
+		logger: logger,
+	}
+}
+
+// Get returns the cached session of the key, or nil if not cached or expired.
+func (c *SessionCache) Get(key string) *LoginResult {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if !c.store.Exists() {
+		return nil
+	}
+	entries, err := c.load()
+	if err != nil {
+		c.logger.Warningf("Session cache is not available: %s", err)
+		return nil
+	}
+	entry, ok := entries[key]
+	if !ok || time.Now().After(entry.ExpiresAt) {
+		return nil
+	}
+	redactor.Add(entry.SessionId)
+	c.logger.Debugf("Use cached session (expires at %s)", entry.ExpiresAt.Format(time.RFC3339))
+	return &LoginResult{
+		SessionId:         entry.SessionId,
+		ServerUrl:         entry.ServerUrl,
+		MetadataServerUrl: entry.MetadataServerUrl,
+	}
+}
+
+// Put caches the session of the key, and removes expired sessions.
+func (c *SessionCache) Put(key string, loginResult *LoginResult) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	entries, err := c.load()
+	if err != nil {
+		c.logger.Warningf("Session cache is not available: %s", err)
+		return
+	}
+	now := time.Now()
+	for k, entry := range entries {
+		if now.After(entry.ExpiresAt) {
+			delete(entries, k)
+		}
+	}
+	entries[key] = &cachedSession{
+		SessionId:         loginResult.SessionId,
+		ServerUrl:         loginResult.ServerUrl,
+		MetadataServerUrl: loginResult.MetadataServerUrl,
+		ExpiresAt:         now.Add(c.ttl),
+	}
+	secrets := map[string]string{}
+	for k, entry := range entries {
+		buf, err := json.Marshal(entry)
+		if err != nil {
+			c.logger.Warningf("Session cache is not saved: %s", err)
+			return
+		}
+		secrets[k] = string(buf)
+	}
+	if err = c.store.Save(secrets); err != nil {
+		c.logger.Warningf("Session cache is not saved: %s", err)
+	}
+}
+
+func (c *SessionCache) load() (map[string]*cachedSession, error) {
+	secrets, err := c.store.Load()
+	if err != nil {
+		return nil, err
+	}
+	entries := map[string]*cachedSession{}
+	for k, v := range secrets {
+		entry := &cachedSession{}
+		if err := json.Unmarshal([]byte(v), entry); err != nil {
+			continue
+		}
+		entries[k] = entry
+	}
+	return entries, nil
+}
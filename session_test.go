@@ -0,0 +1,56 @@
+package main
+
+import (
+	"io/ioutil"
+	"net/http/httptest"
+	"os"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestSessionSharedAndRenewed(t *testing.T) {
+	server := NewMockServer(NewSpmLogger(ioutil.Discard, ioutil.Discard), nil)
+	ts := httptest.NewServer(server)
+	defer ts.Close()
+
+	first := newMockInstaller(t, ts.URL, mockPackageFiles)
+	second := newMockInstaller(t, ts.URL, mockPackageFiles)
+	assert.Equal(t, 1, len(server.sessions))
+	assert.Equal(t, first.client.loginResult.SessionId, second.client.loginResult.SessionId)
+
+	delete(server.sessions, first.client.loginResult.SessionId)
+	assert.Nil(t, first.Install())
+	assert.Nil(t, second.Install())
+	assert.Equal(t, 1, len(server.sessions))
+	assert.Equal(t, first.client.loginResult.SessionId, second.client.loginResult.SessionId)
+}
+
+func TestSessionCache(t *testing.T) {
+	defer withSpmHome(t)()
+	os.Setenv("SPM_PASSPHRASE", "passphrase")
+	defer os.Unsetenv("SPM_PASSPHRASE")
+
+	server := NewMockServer(NewSpmLogger(ioutil.Discard, ioutil.Discard), nil)
+	ts := httptest.NewServer(server)
+	defer ts.Close()
+
+	cache := NewSessionCache(NewSpmLogger(ioutil.Discard, ioutil.Discard), time.Hour)
+	installer := newMockInstaller(t, ts.URL, mockPackageFiles)
+	key := sessionKey(ts.URL, "38.0", &installer.config.credentials)
+	cache.Put(key, installer.client.loginResult)
+
+	buf, err := ioutil.ReadFile(cache.store.path)
+	assert.Nil(t, err)
+	assert.NotContains(t, string(buf), installer.client.loginResult.SessionId)
+
+	loginResult := NewSessionCache(NewSpmLogger(ioutil.Discard, ioutil.Discard), time.Hour).Get(key)
+	assert.NotNil(t, loginResult)
+	assert.Equal(t, installer.client.loginResult.SessionId, loginResult.SessionId)
+	assert.Nil(t, cache.Get("unknown"))
+
+	expired := NewSessionCache(NewSpmLogger(ioutil.Discard, ioutil.Discard), -time.Minute)
+	expired.Put(key, installer.client.loginResult)
+	assert.Nil(t, expired.Get(key))
+}
@@ -0,0 +1,193 @@
+package main
+
+import (
+	"bytes"
+	"compress/gzip"
+	"encoding/xml"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"net"
+	"net/http"
+	"os"
+	"path/filepath"
+	"regexp"
+	"sort"
+	"strings"
+	"sync"
+)
+
+// soapRecorder writes every SOAP envelope when --trace-soap is set.
+var soapRecorder *SOAPRecorder
+
+var recordingFileRegexp = regexp.MustCompile(`^(\d+)-([^-]+)-(request|response)\.xml$`)
+
+// SOAPRecorder writes request and response envelopes as numbered files
+// (i.g. 0001-login-request.xml, 0001-login-response.xml). Secrets are redacted.
+type SOAPRecorder struct {
+	dir string
+	mu  sync.Mutex
+	seq int
+}
+
+func NewSOAPRecorder(dir string) (*SOAPRecorder, error) {
+	if err := os.MkdirAll(dir, 0700); err != nil {
+		return nil, err
+	}
+	return &SOAPRecorder{dir: dir}, nil
+}
+
+func (r *SOAPRecorder) Record(request []byte, response []byte) error {
+	operation := soapOperation(request)
+	if operation == "" {
+		operation = "unknown"
+	}
+	r.mu.Lock()
+	r.seq++
+	seq := r.seq
+	r.mu.Unlock()
+	prefix := filepath.Join(r.dir, fmt.Sprintf("%04d-%s", seq, operation))
+	if err := ioutil.WriteFile(prefix+"-request.xml", []byte(redact(string(request))), 0600); err != nil {
+		return err
+	}
+	return ioutil.WriteFile(prefix+"-response.xml", []byte(redact(string(response))), 0600)
+}
+
+// soapOperation returns the name of the first element in the SOAP body (i.g. deploy).
+func soapOperation(envelope []byte) string {
+	decoder := xml.NewDecoder(bytes.NewReader(envelope))
+	inBody := false
+	for {
+		token, err := decoder.Token()
+		if err != nil {
+			return ""
+		}
+		if se, ok := token.(xml.StartElement); ok {
+			if inBody {
+				return se.Name.Local
+			}
+			inBody = se.Name.Local == "Body"
+		}
+	}
+}
+
+type soapRecording struct {
+	operation string
+	response  []byte
+	used      bool
+}
+
+// SOAPReplayer serves recordings of SOAPRecorder. Each request is answered by
+// the first unused recording of the same operation, in the recorded order.
+type SOAPReplayer struct {
+	mu         sync.Mutex
+	recordings []*soapRecording
+}
+
+func NewSOAPReplayer(dir string) (*SOAPReplayer, error) {
+	entries, err := ioutil.ReadDir(dir)
+	if err != nil {
+		return nil, err
+	}
+	names := []string{}
+	for _, entry := range entries {
+		if m := recordingFileRegexp.FindStringSubmatch(entry.Name()); m != nil && m[3] == "response" {
+			names = append(names, entry.Name())
+		}
+	}
+	sort.Strings(names)
+	replayer := &SOAPReplayer{}
+	for _, name := range names {
+		body, err := ioutil.ReadFile(filepath.Join(dir, name))
+		if err != nil {
+			return nil, err
+		}
+		replayer.recordings = append(replayer.recordings, &soapRecording{
+			operation: recordingFileRegexp.FindStringSubmatch(name)[2],
+			response:  body,
+		})
+	}
+	if len(replayer.recordings) == 0 {
+		return nil, fmt.Errorf("%s: no SOAP recording found", dir)
+	}
+	return replayer, nil
+}
+
+func (s *SOAPReplayer) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	var reader io.Reader = r.Body
+	if r.Header.Get("Content-Encoding") == "gzip" {
+		zr, err := gzip.NewReader(r.Body)
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+		defer zr.Close()
+		reader = zr
+	}
+	body, err := ioutil.ReadAll(reader)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	operation := soapOperation(body)
+	response := s.next(operation)
+	w.Header().Set("Content-Type", "text/xml; charset=utf-8")
+	if response == nil {
+		w.WriteHeader(http.StatusInternalServerError)
+		fmt.Fprintf(w, soapFaultEnvelope, "sf:REPLAY_NOT_FOUND", fmt.Sprintf("REPLAY_NOT_FOUND: No recording left for %s", operation))
+		return
+	}
+	if strings.Contains(string(response), "Fault>") {
+		w.WriteHeader(http.StatusInternalServerError)
+	}
+	w.Write(response)
+}
+
+func (s *SOAPReplayer) next(operation string) []byte {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	for _, recording := range s.recordings {
+		if !recording.used && recording.operation == operation {
+			recording.used = true
+			return recording.response
+		}
+	}
+	return nil
+}
+
+const soapFaultEnvelope = `<?xml version="1.0" encoding="UTF-8"?><soapenv:Envelope xmlns:soapenv="http://schemas.xmlsoap.org/soap/envelope/"><soapenv:Body><soapenv:Fault><faultcode>%s</faultcode><faultstring>%s</faultstring></soapenv:Fault></soapenv:Body></soapenv:Envelope>`
+
+// startSOAPReplay serves the recordings in dir from a local server, and sends every request of spm to it.
+func startSOAPReplay(dir string) (net.Listener, error) {
+	replayer, err := NewSOAPReplayer(dir)
+	if err != nil {
+		return nil, err
+	}
+	l, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		return nil, err
+	}
+	go http.Serve(l, replayer)
+	sharedTransport = &redirectTransport{
+		host: l.Addr().String(),
+		base: &http.Transport{},
+	}
+	return l, nil
+}
+
+// redirectTransport sends every request to the host over plain HTTP.
+type redirectTransport struct {
+	host string
+	base http.RoundTripper
+}
+
+func (t *redirectTransport) RoundTrip(req *http.Request) (*http.Response, error) {
+	r := new(http.Request)
+	*r = *req
+	u := *req.URL
+	u.Scheme = "http"
+	u.Host = t.host
+	r.URL = &u
+	r.Host = t.host
+	return t.base.RoundTrip(r)
+}
@@ -0,0 +1,73 @@
+package main
+
+import (
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+type stubDownloader struct {
+	files []*File
+}
+
+func (d *stubDownloader) Download() ([]*File, error) {
+	return d.files, nil
+}
+
+func TestSOAPRecorder(t *testing.T) {
+	dir, err := ioutil.TempDir("", "trace-soap")
+	assert.Nil(t, err)
+	defer os.RemoveAll(dir)
+	defer func(r *SOAPRecorder) { soapRecorder = r }(soapRecorder)
+	soapRecorder, err = NewSOAPRecorder(dir)
+	assert.Nil(t, err)
+
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Write([]byte(`<?xml version="1.0" encoding="UTF-8"?><soapenv:Envelope xmlns:soapenv="http://schemas.xmlsoap.org/soap/envelope/" xmlns="urn:partner.soap.sforce.com"><soapenv:Body><loginResponse><result><sessionId>00D000000000001!AQ4AQDxyz</sessionId></result></loginResponse></soapenv:Body></soapenv:Envelope>`))
+	}))
+	defer server.Close()
+
+	portType := NewMetadataPortType(server.URL, true, nil)
+	_, err = portType.Login(&LoginRequest{Username: "hoge@example.com", Password: "fuga"})
+	assert.Nil(t, err)
+
+	request, err := ioutil.ReadFile(filepath.Join(dir, "0001-login-request.xml"))
+	assert.Nil(t, err)
+	assert.Contains(t, string(request), "<username>hoge@example.com</username><password>****</password>")
+	recorded, err := ioutil.ReadFile(filepath.Join(dir, "0001-login-response.xml"))
+	assert.Nil(t, err)
+	assert.Contains(t, string(recorded), "<sessionId>****</sessionId>")
+}
+
+func TestSOAPReplay(t *testing.T) {
+	defer func(tr http.RoundTripper) { sharedTransport = tr }(sharedTransport)
+	l, err := startSOAPReplay("test/fixture/soap/deploy-failure")
+	assert.Nil(t, err)
+	defer l.Close()
+
+	downloader := &stubDownloader{files: []*File{
+		{Name: "unpackaged/package.xml", Body: []byte(`<?xml version="1.0" encoding="UTF-8"?><Package xmlns="http://soap.sforce.com/2006/04/metadata"><version>38.0</version></Package>`)},
+	}}
+	config := &config{
+		credentials: credentials{Username: "hoge@example.com", Password: "fuga"},
+		Endpoint:    "login.salesforce.com",
+		ApiVersion:  "38.0",
+	}
+	installer, err := NewSalesforceInstaller(NewSpmLogger(ioutil.Discard, ioutil.Discard), downloader, config, "https://github.com/tzmfreedom/hoge")
+	assert.Nil(t, err)
+	err = installer.Install()
+	_, ok := err.(*DeployError)
+	assert.True(t, ok)
+	assert.EqualError(t, err, "https://github.com/tzmfreedom/hoge: Deploy is failed\n  ApexClass Hoge (line 3, column 5): unexpected token: }")
+	assert.Equal(t, "0Af000000000001AAA", installer.result.DeployId)
+	assert.Equal(t, "Failed", installer.result.Status)
+
+	// every recording is consumed
+	_, err = installer.client.CheckDeployStatus(nil)
+	assert.EqualError(t, err, "REPLAY_NOT_FOUND: No recording left for checkDeployStatus")
+}
@@ -5,14 +5,38 @@ import "os"
 const (
 	ExitCodeOK int = iota
 	ExitCodeError
+	ExitCodeAuthError
+	ExitCodeDownloadError
+	ExitCodeDeployError
+	ExitCodeTestFailure
+	ExitCodeTimeout
 )
 
 func main() {
 	cli := NewCli()
 	err := cli.Run(os.Args)
-	statusCode := ExitCodeOK
-	if err != nil {
-		statusCode = ExitCodeError
+	os.Exit(exitCode(err))
+}
+
+func exitCode(err error) int {
+	switch e := err.(type) {
+	case nil:
+		return ExitCodeOK
+	case *AuthenticationError, *InvalidLoginError, *InvalidSessionError:
+		return ExitCodeAuthError
+	case *DownloadError:
+		if _, ok := e.error.(*timeoutError); ok {
+			return ExitCodeTimeout
+		}
+		return ExitCodeDownloadError
+	case *DeployError:
+		return ExitCodeDeployError
+	case *TestFailureError:
+		return ExitCodeTestFailure
+	case *timeoutError:
+		return ExitCodeTimeout
+	case *DependencyError:
+		return exitCode(e.err)
 	}
-	os.Exit(statusCode)
+	return ExitCodeError
 }
@@ -44,59 +44,59 @@ func TestInstallSuccessForSubdir(t *testing.T) {
 }
 
 func TestInstallFailureNoUsername(t *testing.T) {
-	cli, outStream, _ := before()
+	cli, _, errStream := before()
 	args := strings.Split(fmt.Sprintf("spm install %s -p %s", os.Getenv("REPOSITORY"), os.Getenv("PASSWORD")), " ")
 	_ = cli.Run(args)
-	outString := outStream.String()
-	assert.Contains(t, outString, "Username is required")
+	errString := errStream.String()
+	assert.Contains(t, errString, "Username is required")
 }
 
 func TestInstallFailureNoPassword(t *testing.T) {
-	cli, outStream, _ := before()
+	cli, _, errStream := before()
 	args := strings.Split(fmt.Sprintf("spm install %s -u %s", os.Getenv("REPOSITORY"), os.Getenv("USERNAME")), " ")
 	_ = cli.Run(args)
-	outString := outStream.String()
-	assert.Contains(t, outString, "Password is required")
+	errString := errStream.String()
+	assert.Contains(t, errString, "Password is required")
 }
 
 func TestInstallFailureNoRepository(t *testing.T) {
-	cli, outStream, _ := before()
+	cli, _, errStream := before()
 	args := strings.Split(fmt.Sprintf("spm install -u %s -p %s", os.Getenv("USERNAME"), os.Getenv("PASSWORD")), " ")
 	_ = cli.Run(args)
-	outString := outStream.String()
-	assert.Contains(t, outString, "Repository not specified")
+	errString := errStream.String()
+	assert.Contains(t, errString, "Repository not specified")
 }
 
 func TestInstallFailureNoPackageYML(t *testing.T) {
-	cli, outStream, _ := before()
+	cli, _, errStream := before()
 	args := strings.Split(fmt.Sprintf("spm install -u %s -p %s -P %s", os.Getenv("USERNAME"), os.Getenv("PASSWORD"), "NOPACKAGE.yml"), " ")
 	_ = cli.Run(args)
-	outString := outStream.String()
-	assert.Contains(t, outString, "open NOPACKAGE.yml: no such file or directory")
+	errString := errStream.String()
+	assert.Contains(t, errString, "open NOPACKAGE.yml: no such file or directory")
 }
 
 func TestInstallFailureInvalidCredentials(t *testing.T) {
-	cli, outStream, _ := before()
+	cli, _, errStream := before()
 	args := strings.Split(fmt.Sprintf("spm install %s -u hoge -p fuga", os.Getenv("REPOSITORY")), " ")
 	_ = cli.Run(args)
-	outString := outStream.String()
-	assert.Contains(t, outString, "INVALID_LOGIN: Invalid username, password, security token; or user locked out.")
+	errString := errStream.String()
+	assert.Contains(t, errString, "INVALID_LOGIN: Invalid username, password, security token; or user locked out.")
 }
 
 func TestInstallFailurePackageYmlBlank(t *testing.T) {
-	cli, outStream, _ := before()
+	cli, _, errStream := before()
 	args := strings.Split(fmt.Sprintf("spm install -u %s -p %s -P %s", os.Getenv("USERNAME"), os.Getenv("PASSWORD"), FAILURE_PACKAGE_YML_BLANK), " ")
 	_ = cli.Run(args)
-	outString := outStream.String()
-	assert.Contains(t, outString, "Repository not specified")
+	errString := errStream.String()
+	assert.Contains(t, errString, "Repository not specified")
 }
 
 func TestInstallFailurePackageYmlRepoBlank(t *testing.T) {
-	cli, outStream, _ := before()
+	cli, _, errStream := before()
 	args := strings.Split(fmt.Sprintf("spm install -u %s -p %s -P %s", os.Getenv("USERNAME"), os.Getenv("PASSWORD"), FAILURE_PACKAGE_YML_REPO_BLANK), " ")
 	_ = cli.Run(args)
-	outString := outStream.String()
-	assert.Contains(t, outString, "Repository not specified")
+	errString := errStream.String()
+	assert.Contains(t, errString, "Repository not specified")
 }
 
 func TestDownloadSuccess(t *testing.T) {
@@ -113,22 +113,34 @@ func TestDownloadSuccess(t *testing.T) {
 }
 
 func TestDownloadFailureNoUsername(t *testing.T) {
-	cli, outStream, _ := before()
+	cli, _, errStream := before()
 	args := strings.Split(fmt.Sprintf("spm clone sf://:%s@login.salesforce.com?path=%s", os.Getenv("PASSWORD"), SUCCESS_PACKAGE_TOML), " ")
 	_ = cli.Run(args)
-	outString := outStream.String()
-	assert.Contains(t, outString, "Username is required")
+	errString := errStream.String()
+	assert.Contains(t, errString, "Username is required")
 }
 
 func TestDownloadFailureNoPassword(t *testing.T) {
-	cli, outStream, _ := before()
+	cli, _, errStream := before()
 	args := strings.Split(fmt.Sprintf("spm clone sf://%s:@login.salesforce.com?path=%s", os.Getenv("USERNAME"), SUCCESS_PACKAGE_TOML), " ")
 	_ = cli.Run(args)
-	outString := outStream.String()
-	assert.Contains(t, outString, "Password is required")
+	errString := errStream.String()
+	assert.Contains(t, errString, "Password is required")
 }
 
 func assertIsExists(t *testing.T, filename string) {
 	_, err := os.Stat(filename)
 	assert.Nil(t, err)
 }
+
+func TestLogLevel(t *testing.T) {
+	cli, outStream, errStream := before()
+	_ = cli.Run([]string{"spm", "--quiet", "--log-level", "debug", "status"})
+	assert.Empty(t, outStream.String())
+	assert.Contains(t, errStream.String(), "--verbose, --quiet and --log-level can not be used at the same time")
+
+	cli, outStream, errStream = before()
+	_ = cli.Run([]string{"spm", "--quiet", "install"})
+	assert.Empty(t, outStream.String())
+	assert.Contains(t, errStream.String(), "Repository not specified")
+}
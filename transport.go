@@ -0,0 +1,202 @@
+package main
+
+import (
+	"bytes"
+	"compress/gzip"
+	"crypto/tls"
+	"crypto/x509"
+	"errors"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"net/http"
+	"reflect"
+	"time"
+
+	"gopkg.in/src-d/go-git.v4/plumbing/transport/client"
+	githttp "gopkg.in/src-d/go-git.v4/plumbing/transport/http"
+)
+
+// transportConfig is the TLS and proxy settings shared by the SOAP client, OAuth and git transport.
+type transportConfig struct {
+	CABundle string
+	Insecure bool
+	Timeout  time.Duration
+	Retries  int
+}
+
+// sharedTransport is used by every HTTP request of spm. Connections are kept alive between requests.
+var sharedTransport http.RoundTripper = &http.Transport{
+	Proxy:               http.ProxyFromEnvironment,
+	Dial:                dialTimeout,
+	MaxIdleConnsPerHost: 10,
+	IdleConnTimeout:     90 * time.Second,
+}
+
+// requestTimeout is the timeout of each SOAP request.
+var requestTimeout = 5 * time.Minute
+
+var defaultRetryPolicy = &retryPolicy{
+	MaxRetries: 3,
+	BaseDelay:  time.Second,
+	MaxDelay:   30 * time.Second,
+}
+
+var noRetryPolicy = &retryPolicy{}
+
+func newHTTPTransport(tc *transportConfig) (*http.Transport, error) {
+	tlsConfig := &tls.Config{
+		InsecureSkipVerify: tc.Insecure,
+	}
+	if tc.CABundle != "" {
+		pem, err := ioutil.ReadFile(tc.CABundle)
+		if err != nil {
+			return nil, err
+		}
+		pool, err := x509.SystemCertPool()
+		if err != nil || pool == nil {
+			pool = x509.NewCertPool()
+		}
+		if !pool.AppendCertsFromPEM(pem) {
+			return nil, fmt.Errorf("%s: no certificate found in CA bundle", tc.CABundle)
+		}
+		tlsConfig.RootCAs = pool
+	}
+	return &http.Transport{
+		Proxy:               http.ProxyFromEnvironment,
+		Dial:                dialTimeout,
+		TLSClientConfig:     tlsConfig,
+		MaxIdleConnsPerHost: 10,
+		IdleConnTimeout:     90 * time.Second,
+	}, nil
+}
+
+// configureTransport replaces the shared transport and installs it for git over http(s).
+func configureTransport(tc *transportConfig) error {
+	if tc.Insecure && tc.CABundle != "" {
+		return errors.New("--insecure and --ca-bundle can not be used at the same time")
+	}
+	tr, err := newHTTPTransport(tc)
+	if err != nil {
+		return err
+	}
+	sharedTransport = tr
+	if tc.Timeout > 0 {
+		requestTimeout = tc.Timeout
+	}
+	defaultRetryPolicy.MaxRetries = tc.Retries
+	gitClient := githttp.NewClient(&http.Client{Transport: tr})
+	client.InstallProtocol("https", gitClient)
+	client.InstallProtocol("http", gitClient)
+	return nil
+}
+
+func newHTTPClient() *http.Client {
+	return &http.Client{Transport: sharedTransport}
+}
+
+// retryableError marks a transient failure of a request.
+type retryableError struct {
+	error
+}
+
+type retryPolicy struct {
+	MaxRetries int
+	BaseDelay  time.Duration
+	MaxDelay   time.Duration
+}
+
+// Do calls f until it succeeds or fails with an error other than retryableError.
+// The delay between attempts grows exponentially.
+func (p *retryPolicy) Do(f func() error) error {
+	delay := p.BaseDelay
+	for attempt := 0; ; attempt++ {
+		err := f()
+		re, ok := err.(*retryableError)
+		if !ok {
+			return err
+		}
+		if attempt >= p.MaxRetries {
+			return re.error
+		}
+		time.Sleep(delay)
+		delay *= 2
+		if delay > p.MaxDelay {
+			delay = p.MaxDelay
+		}
+	}
+}
+
+// isIdempotentRequest reports whether the request is safe to be sent again.
+// Deploy submissions are never retried, because the first one may have been accepted.
+func isIdempotentRequest(request interface{}) bool {
+	switch request.(type) {
+	case *Deploy, *DeployRecentValidation, *CreateMetadata, *RenameMetadata:
+		return false
+	}
+	return true
+}
+
+// traceSOAPRequest logs the name, duration and async process ID of the SOAP request at debug level.
+func traceSOAPRequest(logger Logger, request interface{}, response interface{}, duration time.Duration, err error) {
+	name := reflect.Indirect(reflect.ValueOf(request)).Type().Name()
+	msg := fmt.Sprintf("SOAP %s (%s)", name, duration)
+	if id := asyncProcessId(request, response); id != "" {
+		msg += fmt.Sprintf(" asyncProcessId=%s", id)
+	}
+	if err != nil {
+		msg += fmt.Sprintf(" error=%s", err)
+	}
+	logger.Debug(msg)
+}
+
+func asyncProcessId(request interface{}, response interface{}) string {
+	var id *ID
+	switch r := request.(type) {
+	case *CheckDeployStatus:
+		id = r.AsyncProcessId
+	case *CheckRetrieveStatus:
+		id = r.AsyncProcessId
+	case *CancelDeploy:
+		id = r.String
+	}
+	switch r := response.(type) {
+	case *DeployResponse:
+		if r.Result != nil {
+			id = r.Result.Id
+		}
+	case *RetrieveResponse:
+		if r.Result != nil {
+			id = r.Result.Id
+		}
+	}
+	if id == nil {
+		return ""
+	}
+	return string(*id)
+}
+
+func gzipBytes(b []byte) ([]byte, error) {
+	buf := new(bytes.Buffer)
+	zw := gzip.NewWriter(buf)
+	if _, err := zw.Write(b); err != nil {
+		return nil, err
+	}
+	if err := zw.Close(); err != nil {
+		return nil, err
+	}
+	return buf.Bytes(), nil
+}
+
+func readResponseBody(res *http.Response) ([]byte, error) {
+	var r io.Reader = res.Body
+	if res.Header.Get("Content-Encoding") == "gzip" {
+		zr, err := gzip.NewReader(res.Body)
+		if err != nil {
+			return nil, err
+		}
+		defer zr.Close()
+		r = zr
+	}
+	return ioutil.ReadAll(r)
+}
@@ -0,0 +1,95 @@
+package main
+
+import (
+	"encoding/pem"
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestConfigureTransport(t *testing.T) {
+	server := httptest.NewTLSServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {}))
+	defer server.Close()
+	defer func(tr http.RoundTripper, retries int) {
+		sharedTransport = tr
+		defaultRetryPolicy.MaxRetries = retries
+	}(sharedTransport, defaultRetryPolicy.MaxRetries)
+
+	assert.Nil(t, configureTransport(&transportConfig{}))
+	_, err := newHTTPClient().Get(server.URL)
+	assert.Error(t, err)
+
+	f, err := ioutil.TempFile("", "ca-bundle")
+	assert.Nil(t, err)
+	defer os.Remove(f.Name())
+	pem.Encode(f, &pem.Block{Type: "CERTIFICATE", Bytes: server.Certificate().Raw})
+	f.Close()
+
+	assert.Nil(t, configureTransport(&transportConfig{CABundle: f.Name()}))
+	_, err = newHTTPClient().Get(server.URL)
+	assert.Nil(t, err)
+
+	assert.Nil(t, configureTransport(&transportConfig{Insecure: true}))
+	_, err = newHTTPClient().Get(server.URL)
+	assert.Nil(t, err)
+
+	assert.EqualError(t, configureTransport(&transportConfig{CABundle: f.Name(), Insecure: true}), "--insecure and --ca-bundle can not be used at the same time")
+}
+
+func TestSOAPClientRetry(t *testing.T) {
+	defer func(delay time.Duration) { defaultRetryPolicy.BaseDelay = delay }(defaultRetryPolicy.BaseDelay)
+	defaultRetryPolicy.BaseDelay = time.Millisecond
+
+	requests := 0
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		requests++
+		assert.Equal(t, "gzip", r.Header.Get("Content-Encoding"))
+		if requests == 1 {
+			w.WriteHeader(http.StatusServiceUnavailable)
+			return
+		}
+		if requests == 2 {
+			w.WriteHeader(http.StatusInternalServerError)
+			fmt.Fprint(w, `<?xml version="1.0" encoding="UTF-8"?><soapenv:Envelope xmlns:soapenv="http://schemas.xmlsoap.org/soap/envelope/"><soapenv:Body><soapenv:Fault><faultcode>sf:UNKNOWN_EXCEPTION</faultcode><faultstring>UNKNOWN_EXCEPTION: An unexpected error occurred.</faultstring></soapenv:Fault></soapenv:Body></soapenv:Envelope>`)
+			return
+		}
+		w.Header().Set("Content-Encoding", "gzip")
+		body, _ := gzipBytes([]byte(`<?xml version="1.0" encoding="UTF-8"?><soapenv:Envelope xmlns:soapenv="http://schemas.xmlsoap.org/soap/envelope/" xmlns="http://soap.sforce.com/2006/04/metadata"><soapenv:Body><checkDeployStatusResponse><result><done>true</done></result></checkDeployStatusResponse></soapenv:Body></soapenv:Envelope>`))
+		w.Write(body)
+	}))
+	defer server.Close()
+
+	portType := NewMetadataPortType(server.URL, true, nil)
+	response, err := portType.CheckDeployStatus(&CheckDeployStatus{})
+	assert.Nil(t, err)
+	assert.True(t, response.Result.Done)
+	assert.Equal(t, 3, requests)
+
+	requests = 0
+	_, err = portType.Deploy(&Deploy{})
+	assert.Error(t, err)
+	assert.Equal(t, 1, requests)
+}
+
+func TestSOAPClientNotRetryInvalidLogin(t *testing.T) {
+	requests := 0
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		requests++
+		w.WriteHeader(http.StatusInternalServerError)
+		fmt.Fprint(w, `<?xml version="1.0" encoding="UTF-8"?><soapenv:Envelope xmlns:soapenv="http://schemas.xmlsoap.org/soap/envelope/"><soapenv:Body><soapenv:Fault><faultcode>INVALID_LOGIN</faultcode><faultstring>INVALID_LOGIN: Invalid username, password, security token; or user locked out.</faultstring></soapenv:Fault></soapenv:Body></soapenv:Envelope>`)
+	}))
+	defer server.Close()
+
+	portType := NewMetadataPortType(server.URL, true, nil)
+	_, err := portType.Login(&LoginRequest{})
+	assert.EqualError(t, err, "INVALID_LOGIN: Invalid username, password, security token; or user locked out.")
+	_, ok := err.(*InvalidLoginError)
+	assert.True(t, ok)
+	assert.Equal(t, 1, requests)
+}
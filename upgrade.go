@@ -0,0 +1,206 @@
+package main
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"sort"
+)
+
+// UpgradePlan is the difference of components between two commits of a package,
+// i.g. the installed commit and the new one.
+type UpgradePlan struct {
+	Added   []*component
+	Changed []*component
+	Deleted []*component
+	// Skipped are the files of unknown metadata types, neither deployed nor deleted
+	Skipped []string
+}
+
+type componentFiles struct {
+	component *component
+	files     map[string][]byte
+}
+
+// groupByComponent groups the files by the component they belong to, keyed by type and member.
+// Files not belonging to a component (i.g. package.xml) are ignored, and the metadata files whose type
+// is unknown are returned as skipped.
+func groupByComponent(files []*File) (map[string]*componentFiles, []string) {
+	resolver := newComponentResolver(files)
+	groups := map[string]*componentFiles{}
+	skipped := []string{}
+	for _, f := range files {
+		_, name := splitPackageRoot(f.Name)
+		c, ok := resolver.componentOf(name)
+		if !ok {
+			if isMetadataFile(name) {
+				skipped = append(skipped, name)
+			}
+			continue
+		}
+		key := c.Type + "/" + c.Member
+		if _, ok := groups[key]; !ok {
+			groups[key] = &componentFiles{component: c, files: map[string][]byte{}}
+		}
+		groups[key].files[name] = f.Body
+	}
+	return groups, skipped
+}
+
+// planUpgrade compares the files of the installed commit with the new files.
+// A component is changed if any of its files is added, removed or modified.
+func planUpgrade(oldFiles []*File, newFiles []*File) *UpgradePlan {
+	olds, oldSkipped := groupByComponent(oldFiles)
+	news, newSkipped := groupByComponent(newFiles)
+	plan := &UpgradePlan{}
+	for _, name := range append(oldSkipped, newSkipped...) {
+		if !containsString(plan.Skipped, name) {
+			plan.Skipped = append(plan.Skipped, name)
+		}
+	}
+	sort.Strings(plan.Skipped)
+	for key, n := range news {
+		o, ok := olds[key]
+		if !ok {
+			plan.Added = append(plan.Added, n.component)
+			continue
+		}
+		if !sameFiles(o.files, n.files) {
+			plan.Changed = append(plan.Changed, n.component)
+		}
+	}
+	for key, o := range olds {
+		if _, ok := news[key]; !ok {
+			plan.Deleted = append(plan.Deleted, o.component)
+		}
+	}
+	plan.Added = newPackageXML(plan.Added, "").Components()
+	plan.Changed = newPackageXML(plan.Changed, "").Components()
+	plan.Deleted = newPackageXML(plan.Deleted, "").Components()
+	return plan
+}
+
+func sameFiles(a map[string][]byte, b map[string][]byte) bool {
+	if len(a) != len(b) {
+		return false
+	}
+	for name, body := range a {
+		other, ok := b[name]
+		if !ok || !bytes.Equal(body, other) {
+			return false
+		}
+	}
+	return true
+}
+
+// Files returns the files deploying the plan: the files of added and changed components, package.yml,
+// package.xml of those components, and destructiveChangesPost.xml of the deleted components and extra deletes.
+func (p *UpgradePlan) Files(newFiles []*File, deletes []*component) ([]*File, error) {
+	deploys := append(append([]*component{}, p.Added...), p.Changed...)
+	var manifest *packageXML
+	root := "unpackaged"
+	files := []*File{}
+	resolver := newComponentResolver(newFiles)
+	for _, f := range newFiles {
+		r, name := splitPackageRoot(f.Name)
+		if name == "package.xml" {
+			m, err := parsePackageXML(f.Body)
+			if err != nil {
+				return nil, err
+			}
+			manifest = m
+			root = r
+			continue
+		}
+		if name == "package.yml" {
+			files = append(files, f)
+			continue
+		}
+		if c, ok := resolver.componentOf(name); ok && containsComponent(deploys, c) {
+			files = append(files, f)
+		}
+	}
+	if manifest == nil {
+		return nil, errors.New("Package.xml Not Found")
+	}
+	files = append(files, &File{Name: root + "/package.xml", Body: newPackageXML(deploys, manifest.Version).Bytes()})
+	deletes = append(append([]*component{}, p.Deleted...), deletes...)
+	if len(deletes) > 0 {
+		files = append(files, &File{Name: root + "/destructiveChangesPost.xml", Body: newPackageXML(deletes, "").Bytes()})
+	}
+	return files, nil
+}
+
+func (i *SalesforceInstaller) Upgrade() error {
+	i.result = NewPackageResult(i.uri)
+	err := i.upgrade()
+	i.finish(err)
+	return err
+}
+
+// upgrade deploys the components added or changed since the commit recorded at the last install,
+// and deletes the components removed from the package after the deployment.
+// The plan is only shown unless --yes is given.
+func (i *SalesforceInstaller) upgrade() error {
+	if _, ok := i.downloader.(*VendorDownloader); ok {
+		return fmt.Errorf("%s: Upgrade needs the commit recorded at the last install, which is not vendored. Use --vendor-dir \"\" to clone the repository", i.uri)
+	}
+	gd, ok := i.downloader.(*GitDownloader)
+	if !ok {
+		return fmt.Errorf("%s: Upgrade supports git repositories only", i.uri)
+	}
+	var record *PackageRecord
+	if i.registry != nil {
+		record = i.registry.Find(i.uri)
+	}
+	if record == nil || record.Commit == "" {
+		return fmt.Errorf("%s: The package is not installed by spm. Use spm install", i.uri)
+	}
+	files, err := i.download()
+	if err != nil {
+		return err
+	}
+	if record.Commit == i.result.Commit {
+		i.logger.Infof("%s: Already up to date (commit: %s)", i.uri, record.Commit)
+		return nil
+	}
+	oldFiles, err := gd.DownloadCommit(record.Commit)
+	if err != nil {
+		return &DownloadError{err}
+	}
+	plan := planUpgrade(oldFiles, files)
+	// the record is renamed if the package is upgraded to another ref
+	deletes := []*component{}
+	if registryName(record.URI) != registryName(i.uri) {
+		deletes = append(deletes, record.Component())
+	}
+
+	i.logger.Infof("%s: Upgrade from %s to %s", i.uri, record.Commit, i.result.Commit)
+	i.logPlan(plan)
+	if !i.config.Yes && !i.config.DryRun {
+		i.logger.Infof("%s: Run with --yes to apply the plan", i.uri)
+		return nil
+	}
+
+	files, err = plan.Files(files, deletes)
+	if err != nil {
+		return err
+	}
+	return i.deploy(files)
+}
+
+func (i *SalesforceInstaller) logPlan(plan *UpgradePlan) {
+	for _, c := range plan.Added {
+		i.logger.Infof("  + %s %s", c.Type, c.Member)
+	}
+	for _, c := range plan.Changed {
+		i.logger.Infof("  ~ %s %s", c.Type, c.Member)
+	}
+	for _, c := range plan.Deleted {
+		i.logger.Infof("  - %s %s", c.Type, c.Member)
+	}
+	for _, name := range plan.Skipped {
+		i.logger.Warningf("%s: %s is skipped. The metadata type of the file is unknown. List it in package.xml", i.uri, name)
+	}
+	i.logger.Infof("%s: %d to add, %d to change, %d to delete", i.uri, len(plan.Added), len(plan.Changed), len(plan.Deleted))
+}
@@ -0,0 +1,113 @@
+package main
+
+import (
+	"io/ioutil"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestPlanUpgrade(t *testing.T) {
+	oldFiles := []*File{
+		{Name: "unpackaged/package.xml", Body: newPackageXML([]*component{{Type: "ApexClass", Member: "*"}}, "38.0").Bytes()},
+		{Name: "unpackaged/classes/Hoge.cls", Body: []byte("public class Hoge {}")},
+		{Name: "unpackaged/classes/Hoge.cls-meta.xml", Body: []byte("<ApexClass/>")},
+		{Name: "unpackaged/classes/Fuga.cls", Body: []byte("public class Fuga {}")},
+		{Name: "unpackaged/classes/Fuga.cls-meta.xml", Body: []byte("<ApexClass/>")},
+		{Name: "unpackaged/classes/Piyo.cls", Body: []byte("public class Piyo {}")},
+		{Name: "unpackaged/classes/Piyo.cls-meta.xml", Body: []byte("<ApexClass/>")},
+	}
+	newFiles := []*File{
+		{Name: "unpackaged/package.xml", Body: newPackageXML([]*component{{Type: "ApexClass", Member: "*"}}, "39.0").Bytes()},
+		{Name: "unpackaged/package.yml", Body: []byte("dependencies: []\n")},
+		{Name: "unpackaged/classes/Hoge.cls", Body: []byte("public class Hoge {}")},
+		{Name: "unpackaged/classes/Hoge.cls-meta.xml", Body: []byte("<ApexClass/>")},
+		{Name: "unpackaged/classes/Fuga.cls", Body: []byte("public class Fuga { Integer i; }")},
+		{Name: "unpackaged/classes/Fuga.cls-meta.xml", Body: []byte("<ApexClass/>")},
+		{Name: "unpackaged/objects/Foo__c.object", Body: []byte("<CustomObject/>")},
+	}
+	plan := planUpgrade(oldFiles, newFiles)
+	assert.Equal(t, []*component{{Type: "CustomObject", Member: "Foo__c"}}, plan.Added)
+	assert.Equal(t, []*component{{Type: "ApexClass", Member: "Fuga"}}, plan.Changed)
+	assert.Equal(t, []*component{{Type: "ApexClass", Member: "Piyo"}}, plan.Deleted)
+
+	files, err := plan.Files(newFiles, []*component{{Type: "StaticResource", Member: "spm_old"}})
+	assert.Nil(t, err)
+	bodies := map[string]string{}
+	for _, f := range files {
+		bodies[f.Name] = string(f.Body)
+	}
+	assert.NotContains(t, bodies, "unpackaged/classes/Hoge.cls")
+	assert.Contains(t, bodies, "unpackaged/classes/Fuga.cls")
+	assert.Contains(t, bodies, "unpackaged/classes/Fuga.cls-meta.xml")
+	assert.Contains(t, bodies, "unpackaged/objects/Foo__c.object")
+	assert.Contains(t, bodies, "unpackaged/package.yml")
+
+	manifest, err := parsePackageXML([]byte(bodies["unpackaged/package.xml"]))
+	assert.Nil(t, err)
+	assert.Equal(t, "39.0", manifest.Version)
+	assert.Equal(t, []*component{{Type: "ApexClass", Member: "Fuga"}, {Type: "CustomObject", Member: "Foo__c"}}, manifest.Components())
+
+	destructive, err := parsePackageXML([]byte(bodies["unpackaged/destructiveChangesPost.xml"]))
+	assert.Nil(t, err)
+	assert.Equal(t, []*component{{Type: "ApexClass", Member: "Piyo"}, {Type: "StaticResource", Member: "spm_old"}}, destructive.Components())
+}
+
+func TestPlanUpgradeUnknownTypes(t *testing.T) {
+	oldFiles := []*File{
+		{Name: "unpackaged/package.xml", Body: newPackageXML([]*component{{Type: "QuickText", Member: "Hoge"}, {Type: "QuickText", Member: "Fuga"}}, "38.0").Bytes()},
+		{Name: "unpackaged/quickTexts/Hoge.quickText", Body: []byte("<QuickText><message>hoge</message></QuickText>")},
+		{Name: "unpackaged/quickTexts/Fuga.quickText", Body: []byte("<QuickText/>")},
+		{Name: "unpackaged/reportTypes/Hoge.reportType", Body: []byte("<ReportType/>")},
+	}
+	newFiles := []*File{
+		{Name: "unpackaged/package.xml", Body: newPackageXML([]*component{{Type: "QuickText", Member: "Hoge"}, {Type: "ReportType", Member: "*"}}, "38.0").Bytes()},
+		{Name: "unpackaged/quickTexts/Hoge.quickText", Body: []byte("<QuickText><message>fuga</message></QuickText>")},
+		{Name: "unpackaged/reportTypes/Hoge.reportType", Body: []byte("<ReportType><label>Hoge</label></ReportType>")},
+		{Name: "unpackaged/unknowns/Hoge.unknown", Body: []byte("<Unknown/>")},
+		{Name: "unpackaged/.github/workflows/ci.yml", Body: []byte("on: push")},
+	}
+	plan := planUpgrade(oldFiles, newFiles)
+	assert.Equal(t, 0, len(plan.Added))
+	assert.Equal(t, []*component{{Type: "QuickText", Member: "Hoge"}, {Type: "ReportType", Member: "Hoge"}}, plan.Changed)
+	assert.Equal(t, []*component{{Type: "QuickText", Member: "Fuga"}}, plan.Deleted)
+	assert.Equal(t, []string{"unknowns/Hoge.unknown"}, plan.Skipped)
+
+	files, err := plan.Files(newFiles, nil)
+	assert.Nil(t, err)
+	bodies := map[string]string{}
+	for _, f := range files {
+		bodies[f.Name] = string(f.Body)
+	}
+	assert.Contains(t, bodies, "unpackaged/quickTexts/Hoge.quickText")
+	assert.Contains(t, bodies, "unpackaged/reportTypes/Hoge.reportType")
+	assert.NotContains(t, bodies, "unpackaged/unknowns/Hoge.unknown")
+	manifest, err := parsePackageXML([]byte(bodies["unpackaged/package.xml"]))
+	assert.Nil(t, err)
+	assert.Equal(t, plan.Changed, manifest.Components())
+}
+
+func TestRegistryFind(t *testing.T) {
+	r := NewRegistry()
+	master := NewPackageRecord("https://github.com/tzmfreedom/hoge", nil)
+	master.InstalledAt = time.Now().Add(-time.Hour)
+	develop := NewPackageRecord("https://github.com/tzmfreedom/hoge@develop", nil)
+	r.Add(master)
+	r.Add(develop)
+	r.Add(NewPackageRecord("https://github.com/tzmfreedom/fuga", nil))
+
+	assert.Equal(t, master, r.Find("https://github.com/tzmfreedom/hoge"))
+	assert.Equal(t, develop, r.Find("https://github.com/tzmfreedom/hoge@v2.0"))
+	assert.Nil(t, r.Find("https://github.com/tzmfreedom/piyo"))
+}
+
+func TestUpgradeRequiresGitRepository(t *testing.T) {
+	installer := &SalesforceInstaller{
+		uri:        "sf://hoge:fuga@login.salesforce.com",
+		downloader: &stubDownloader{},
+		config:     &config{},
+		logger:     NewSpmLogger(ioutil.Discard, ioutil.Discard),
+	}
+	assert.EqualError(t, installer.Upgrade(), "sf://hoge:fuga@login.salesforce.com: Upgrade supports git repositories only")
+}
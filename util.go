@@ -72,12 +72,16 @@ func convertToUrl(target string) (string, error) {
 }
 
 func readPackageFile(packageFileStr string) (*PackageFile, error) {
-	packageFile := PackageFile{}
 	readBody, err := ioutil.ReadFile(packageFileStr)
 	if err != nil {
 		return nil, err
 	}
-	err = yaml.Unmarshal([]byte(readBody), &packageFile)
+	return parsePackageFile(readBody)
+}
+
+func parsePackageFile(body []byte) (*PackageFile, error) {
+	packageFile := PackageFile{}
+	err := yaml.Unmarshal(body, &packageFile)
 	if err != nil {
 		return nil, err
 	}
@@ -137,3 +141,42 @@ func unzip(buf []byte, dest string) error {
 
 	return nil
 }
+
+// unzipFiles extracts a metadata zip into files in memory.
+func unzipFiles(buf []byte) ([]*File, error) {
+	r, err := zip.NewReader(bytes.NewReader(buf), int64(len(buf)))
+	if err != nil {
+		return nil, err
+	}
+	files := []*File{}
+	for _, f := range r.File {
+		if f.FileInfo().IsDir() {
+			continue
+		}
+		rc, err := f.Open()
+		if err != nil {
+			return nil, err
+		}
+		b, err := ioutil.ReadAll(rc)
+		rc.Close()
+		if err != nil {
+			return nil, err
+		}
+		files = append(files, &File{Name: f.Name, Body: b})
+	}
+	return files, nil
+}
+
+// isZipped reports whether files are a zip retrieved from salesforce rather than the package files.
+func isZipped(files []*File) bool {
+	return len(files) == 1 && files[0].Name == ""
+}
+
+// writeFileAtomic writes data to a temporary file and renames it, so readers never see a partial file.
+func writeFileAtomic(filename string, data []byte, perm os.FileMode) error {
+	tmp := filename + ".tmp"
+	if err := ioutil.WriteFile(tmp, data, perm); err != nil {
+		return err
+	}
+	return os.Rename(tmp, filename)
+}
@@ -0,0 +1,182 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+)
+
+const (
+	// VENDOR_DIR is the default directory of the packages vendored by spm vendor
+	VENDOR_DIR = "spm_vendor"
+	// VENDOR_LOCK is the name of the lock file in the vendor directory
+	VENDOR_LOCK = "spm.lock"
+)
+
+// VendorLock is the lock file of the vendor directory. It lists the vendored packages
+// of the dependency tree with the commits they are vendored at.
+type VendorLock struct {
+	SpmVersion string             `json:"spm_version"`
+	VendoredAt time.Time          `json:"vendored_at"`
+	Packages   []*VendoredPackage `json:"packages"`
+	dir        string
+}
+
+type VendoredPackage struct {
+	URI          string   `json:"uri"`
+	Commit       string   `json:"commit,omitempty"`
+	Dependencies []string `json:"dependencies,omitempty"`
+	// Dir is the directory of the package files, relative to the vendor directory
+	Dir string `json:"dir"`
+}
+
+// Find returns the vendored package of the URI.
+func (l *VendorLock) Find(uri string) *VendoredPackage {
+	for _, p := range l.Packages {
+		if p.URI == uri {
+			return p
+		}
+	}
+	return nil
+}
+
+// downloader returns the downloader of the vendored copy of the package. Packages of orgs are
+// retrieved from salesforce as usual, since spm vendor does not vendor them. Other packages missing
+// from the lock are errors instead of being cloned, so that nothing is fetched from git hosts.
+func (l *VendorLock) downloader(logger Logger, uri string) (Downloader, error) {
+	if p := l.Find(uri); p != nil {
+		return &VendorDownloader{logger: logger, dir: filepath.Join(l.dir, p.Dir), pkg: p}, nil
+	}
+	if strings.HasPrefix(uri, "sf://") {
+		return dispatchDownloader(logger, uri)
+	}
+	return nil, fmt.Errorf("%s is not vendored in %s. Run spm vendor", uri, l.dir)
+}
+
+// readVendorLock reads the lock file of the vendor directory. It returns nil if the directory is not vendored.
+func readVendorLock(dir string) (*VendorLock, error) {
+	buf, err := ioutil.ReadFile(filepath.Join(dir, VENDOR_LOCK))
+	if os.IsNotExist(err) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	l := &VendorLock{dir: dir}
+	if err := json.Unmarshal(buf, l); err != nil {
+		return nil, fmt.Errorf("%s: %s", filepath.Join(dir, VENDOR_LOCK), err)
+	}
+	return l, nil
+}
+
+// VendorDownloader reads the files of a package vendored by spm vendor instead of cloning the repository.
+type VendorDownloader struct {
+	logger Logger
+	dir    string
+	pkg    *VendoredPackage
+}
+
+func (d *VendorDownloader) Download() ([]*File, error) {
+	d.logger.Infof("Read vendored %s from %s (commit: %s)", d.pkg.URI, d.dir, d.pkg.Commit)
+	files := []*File{}
+	err := filepath.Walk(d.dir, func(path string, info os.FileInfo, err error) error {
+		if err != nil {
+			return err
+		}
+		if info.IsDir() {
+			return nil
+		}
+		body, err := ioutil.ReadFile(path)
+		if err != nil {
+			return err
+		}
+		name, err := filepath.Rel(d.dir, path)
+		if err != nil {
+			return err
+		}
+		files = append(files, &File{Name: filepath.ToSlash(name), Body: body})
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+	return files, nil
+}
+
+// vendor downloads the packages and their dependencies recursively, and writes their files
+// and the lock file to the directory. Packages other than git repositories are not vendored,
+// since they are retrieved from salesforce.
+func vendor(logger Logger, uris []string, dir string, newDownloader func(logger Logger, uri string) (Downloader, error)) (*VendorLock, error) {
+	lock := &VendorLock{SpmVersion: Version, VendoredAt: time.Now(), Packages: []*VendoredPackage{}, dir: dir}
+	seen := map[string]bool{}
+	for len(uris) > 0 {
+		uri := uris[0]
+		uris = uris[1:]
+		if seen[uri] {
+			continue
+		}
+		seen[uri] = true
+		if strings.HasPrefix(uri, "sf://") {
+			logger.Infof("%s: Not vendored, since the package is retrieved from salesforce", registryURI(uri))
+			continue
+		}
+		downloader, err := newDownloader(logger, uri)
+		if err != nil {
+			return nil, err
+		}
+		files, err := downloader.Download()
+		if err != nil {
+			return nil, &DownloadError{err}
+		}
+		deps, err := packageDependencies(files)
+		if err != nil {
+			return nil, err
+		}
+		p := &VendoredPackage{
+			URI:          uri,
+			Dependencies: deps,
+			Dir:          strings.TrimPrefix(registryName(uri), REGISTRY_PREFIX),
+		}
+		if gd, ok := downloader.(*GitDownloader); ok {
+			p.Commit = gd.commit
+		}
+		if err := writeVendoredFiles(filepath.Join(dir, p.Dir), files); err != nil {
+			return nil, err
+		}
+		logger.Infof("%s: Vendored to %s (commit: %s)", uri, filepath.Join(dir, p.Dir), p.Commit)
+		lock.Packages = append(lock.Packages, p)
+		uris = append(uris, deps...)
+	}
+	buf, err := json.MarshalIndent(lock, "", "  ")
+	if err != nil {
+		return nil, err
+	}
+	if err := os.MkdirAll(dir, 0755); err != nil {
+		return nil, err
+	}
+	if err := writeFileAtomic(filepath.Join(dir, VENDOR_LOCK), buf, 0644); err != nil {
+		return nil, err
+	}
+	return lock, nil
+}
+
+// writeVendoredFiles replaces the directory with the files of the package.
+func writeVendoredFiles(dir string, files []*File) error {
+	if err := os.RemoveAll(dir); err != nil {
+		return err
+	}
+	for _, f := range files {
+		path := filepath.Join(dir, filepath.FromSlash(f.Name))
+		if err := os.MkdirAll(filepath.Dir(path), 0755); err != nil {
+			return err
+		}
+		if err := ioutil.WriteFile(path, f.Body, 0644); err != nil {
+			return err
+		}
+	}
+	return nil
+}
@@ -0,0 +1,90 @@
+package main
+
+import (
+	"io/ioutil"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestVendor(t *testing.T) {
+	dir, err := ioutil.TempDir("", "spm")
+	assert.Nil(t, err)
+	defer os.RemoveAll(dir)
+	vendorDir := filepath.Join(dir, VENDOR_DIR)
+
+	packages := map[string][]*File{
+		"https://github.com/tzmfreedom/a": packageFiles("A", "packages:\n  - tzmfreedom/b\n  - sf://hoge@example.com:fuga@login.salesforce.com\n"),
+		"https://github.com/tzmfreedom/b": packageFiles("B", "packages:\n  - tzmfreedom/a\n"),
+	}
+	lock, err := vendor(NewSpmLogger(ioutil.Discard, ioutil.Discard), []string{"https://github.com/tzmfreedom/a"}, vendorDir, func(logger Logger, uri string) (Downloader, error) {
+		return &stubDownloader{files: packages[uri]}, nil
+	})
+	assert.Nil(t, err)
+	assert.Equal(t, 2, len(lock.Packages))
+	assert.Equal(t, "https://github.com/tzmfreedom/a", lock.Packages[0].URI)
+	assert.Equal(t, "https://github.com/tzmfreedom/b", lock.Packages[1].URI)
+
+	read, err := readVendorLock(vendorDir)
+	assert.Nil(t, err)
+	assert.Equal(t, lock.Packages, read.Packages)
+	buf, err := ioutil.ReadFile(filepath.Join(vendorDir, read.Packages[1].Dir, "unpackaged", "classes", "B.cls"))
+	assert.Nil(t, err)
+	assert.Equal(t, "public class B {}", string(buf))
+
+	downloader, err := read.downloader(NewSpmLogger(ioutil.Discard, ioutil.Discard), "https://github.com/tzmfreedom/b")
+	assert.Nil(t, err)
+	files, err := downloader.Download()
+	assert.Nil(t, err)
+	assert.Equal(t, len(packages["https://github.com/tzmfreedom/b"]), len(files))
+
+	_, err = read.downloader(NewSpmLogger(ioutil.Discard, ioutil.Discard), "https://github.com/tzmfreedom/c")
+	assert.EqualError(t, err, "https://github.com/tzmfreedom/c is not vendored in "+vendorDir+". Run spm vendor")
+	_, err = read.downloader(NewSpmLogger(ioutil.Discard, ioutil.Discard), "sf://hoge@example.com:fuga@login.salesforce.com")
+	assert.Nil(t, err)
+
+	read, err = readVendorLock(filepath.Join(dir, "none"))
+	assert.Nil(t, err)
+	assert.Nil(t, read)
+}
+
+func TestInstallVendored(t *testing.T) {
+	dir, err := ioutil.TempDir("", "spm")
+	assert.Nil(t, err)
+	defer os.RemoveAll(dir)
+
+	packages := map[string][]*File{
+		"https://github.com/tzmfreedom/a": packageFiles("A", "packages:\n  - tzmfreedom/b\n"),
+		"https://github.com/tzmfreedom/b": packageFiles("B", ""),
+	}
+	lock, err := vendor(NewSpmLogger(ioutil.Discard, ioutil.Discard), []string{"https://github.com/tzmfreedom/a"}, dir, func(logger Logger, uri string) (Downloader, error) {
+		return &stubDownloader{files: packages[uri]}, nil
+	})
+	assert.Nil(t, err)
+	lock.Packages[0].Commit = "3f2a"
+
+	server := httptest.NewServer(NewMockServer(NewSpmLogger(ioutil.Discard, ioutil.Discard), nil))
+	defer server.Close()
+	p := newParallelInstaller(server.URL, nil)
+	p.newDownloader = lock.downloader
+	assert.Nil(t, p.Install([]string{"https://github.com/tzmfreedom/a"}))
+	assert.Equal(t, 2, len(p.report.Packages))
+	assert.Equal(t, "https://github.com/tzmfreedom/b", p.report.Packages[0].URI)
+	assert.Equal(t, "3f2a", p.report.Packages[1].Commit)
+	for _, result := range p.report.Packages {
+		assert.Equal(t, "Succeeded", result.Status)
+	}
+}
+
+func TestUpgradeVendored(t *testing.T) {
+	installer := &SalesforceInstaller{
+		uri:        "https://github.com/tzmfreedom/a",
+		downloader: &VendorDownloader{pkg: &VendoredPackage{URI: "https://github.com/tzmfreedom/a"}},
+		config:     &config{},
+		logger:     NewSpmLogger(ioutil.Discard, ioutil.Discard),
+	}
+	assert.EqualError(t, installer.Upgrade(), "https://github.com/tzmfreedom/a: Upgrade needs the commit recorded at the last install, which is not vendored. Use --vendor-dir \"\" to clone the repository")
+}
@@ -0,0 +1,157 @@
+package main
+
+import (
+	"bytes"
+	"encoding/xml"
+	"errors"
+	"io"
+	"strings"
+)
+
+// xmlNode is a minimal DOM for metadata xml files.
+// Element and attribute names are kept as written, so namespace prefixes survive a round trip.
+type xmlNode struct {
+	Name     string
+	Attr     []xml.Attr
+	Children []*xmlNode
+	Text     string
+	Comment  bool
+}
+
+type xmlDocument struct {
+	Root *xmlNode
+}
+
+func parseXML(b []byte) (*xmlDocument, error) {
+	decoder := xml.NewDecoder(bytes.NewReader(b))
+	decoder.Strict = false
+	stack := []*xmlNode{}
+	doc := &xmlDocument{}
+	for {
+		token, err := decoder.RawToken()
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			return nil, err
+		}
+		switch t := token.(type) {
+		case xml.StartElement:
+			node := &xmlNode{Name: rawName(t.Name), Attr: t.Attr}
+			if len(stack) == 0 {
+				if doc.Root != nil {
+					return nil, errors.New("multiple root elements")
+				}
+				doc.Root = node
+			} else {
+				parent := stack[len(stack)-1]
+				parent.Children = append(parent.Children, node)
+			}
+			stack = append(stack, node)
+		case xml.EndElement:
+			if len(stack) == 0 {
+				return nil, errors.New("unexpected end element")
+			}
+			stack = stack[:len(stack)-1]
+		case xml.CharData:
+			if len(stack) > 0 {
+				stack[len(stack)-1].Text += string(t)
+			}
+		case xml.Comment:
+			if len(stack) > 0 {
+				parent := stack[len(stack)-1]
+				parent.Children = append(parent.Children, &xmlNode{Text: string(t), Comment: true})
+			}
+		}
+	}
+	if doc.Root == nil {
+		return nil, errors.New("root element not found")
+	}
+	return doc, nil
+}
+
+func rawName(name xml.Name) string {
+	if name.Space == "" {
+		return name.Local
+	}
+	return name.Space + ":" + name.Local
+}
+
+// Bytes serializes the document in the format of salesforce metadata API.
+func (d *xmlDocument) Bytes() []byte {
+	buf := new(bytes.Buffer)
+	buf.WriteString("<?xml version=\"1.0\" encoding=\"UTF-8\"?>\n")
+	d.Root.write(buf, 0)
+	return buf.Bytes()
+}
+
+func (n *xmlNode) write(buf *bytes.Buffer, depth int) {
+	indent := strings.Repeat("    ", depth)
+	if n.Comment {
+		buf.WriteString(indent + "<!--" + n.Text + "-->\n")
+		return
+	}
+	buf.WriteString(indent + "<" + n.Name)
+	for _, attr := range n.Attr {
+		buf.WriteString(" " + rawName(attr.Name) + "=\"" + escapeXMLText(attr.Value) + "\"")
+	}
+	if len(n.Children) == 0 {
+		if n.Text == "" {
+			buf.WriteString("/>\n")
+			return
+		}
+		buf.WriteString(">" + escapeXMLText(n.Text) + "</" + n.Name + ">\n")
+		return
+	}
+	buf.WriteString(">\n")
+	for _, child := range n.Children {
+		child.write(buf, depth+1)
+	}
+	buf.WriteString(indent + "</" + n.Name + ">\n")
+}
+
+var xmlTextEscaper = strings.NewReplacer(
+	"&", "&amp;",
+	"<", "&lt;",
+	">", "&gt;",
+	"\"", "&quot;",
+	"'", "&apos;",
+)
+
+func escapeXMLText(s string) string {
+	return xmlTextEscaper.Replace(s)
+}
+
+// Child returns the first child element with the name.
+func (n *xmlNode) Child(name string) *xmlNode {
+	for _, child := range n.Children {
+		if !child.Comment && child.Name == name {
+			return child
+		}
+	}
+	return nil
+}
+
+// ChildText returns the text of the first child element with the name.
+func (n *xmlNode) ChildText(name string) string {
+	child := n.Child(name)
+	if child == nil {
+		return ""
+	}
+	return strings.TrimSpace(child.Text)
+}
+
+// RemoveChildren removes the child elements for which f returns true and reports how many were removed.
+func (n *xmlNode) RemoveChildren(f func(*xmlNode) bool) int {
+	children := n.Children[:0]
+	removed := 0
+	for _, child := range n.Children {
+		if !child.Comment && f(child) {
+			removed++
+			continue
+		}
+		children = append(children, child)
+	}
+	n.Children = children
+	return removed
+}